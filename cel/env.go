@@ -5,6 +5,7 @@ import (
 
 	"github.com/google/cel-go/cel"
 	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/ext"
 	resultspb "github.com/tektoncd/results/proto/v1alpha2/results_go_proto"
 )
 
@@ -24,6 +25,8 @@ func NewResultsEnv() (*cel.Env, error) {
 		cel.Variable("annotations", cel.MapType(cel.StringType, cel.StringType)),
 		cel.Variable("summary",
 			cel.ObjectType("tekton.results.v1alpha2.RecordSummary")),
+		nowFunction(),
+		ext.Strings(),
 	)
 }
 
@@ -36,9 +39,16 @@ func NewRecordsEnv() (*cel.Env, error) {
 		cel.Declarations(decls.NewVar("name", decls.String)),
 		cel.Declarations(decls.NewVar("data_type", decls.String)),
 		cel.Declarations(decls.NewVar("data", decls.Any)),
+		nowFunction(),
+		ext.Strings(),
 	)
 }
 
+// nowFunction declares the now() function, which returns the current time.
+func nowFunction() cel.EnvOption {
+	return cel.Function("now", cel.Overload("now", []*cel.Type{}, cel.TimestampType))
+}
+
 // stringConst is a helper to create a CEL string constant declaration.
 func stringConst(name, value string) *exprpb.Decl {
 	return decls.NewConst(name,
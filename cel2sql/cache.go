@@ -0,0 +1,115 @@
+package cel2sql
+
+import (
+	linkedlist "container/list"
+	"sync"
+	"time"
+
+	"github.com/google/cel-go/cel"
+)
+
+// Cache is a bounded cache of compiled filters, which evicts the least recently
+// used ones when it's full. It's safe for concurrent use.
+type Cache struct {
+	size int
+	opts []Option
+
+	mu      sync.Mutex
+	entries map[cacheKey]*linkedlist.Element
+	// recent orders the entries from the most to the least recently used.
+	recent *linkedlist.List
+}
+
+type cacheKey struct {
+	env  *cel.Env
+	expr string
+
+	// callsNow indicates whether the filter calls the now() function, in
+	// which case it's cached for each instant now refers to.
+	callsNow bool
+	now      time.Time
+}
+
+type cacheEntry struct {
+	key    cacheKey
+	filter *Filter
+}
+
+// NewCache returns a cache holding up to size filters, which are compiled with
+// the provided options.
+func NewCache(size int, opts ...Option) *Cache {
+	return &Cache{
+		size:    size,
+		opts:    opts,
+		entries: map[cacheKey]*linkedlist.Element{},
+		recent:  linkedlist.New(),
+	}
+}
+
+// Compile returns the filter compiled from the CEL expression in the
+// environment, which is only compiled if it isn't cached already. The now()
+// function refers to the provided instant, as set by the WithNow option. Only
+// the filters that call now() are cached for each instant, so the other ones
+// are shared by the queries run at different times. Errors aren't cached.
+func (c *Cache) Compile(env *cel.Env, filters string, now time.Time) (*Filter, error) {
+	key := cacheKey{env: env, expr: filters}
+	if filter, found := c.get(key); found {
+		return filter, nil
+	}
+	// Instants are compared regardless of their location and of their
+	// monotonic clock reading.
+	nowKey := cacheKey{env: env, expr: filters, callsNow: true, now: now.Round(0).UTC()}
+	if filter, found := c.get(nowKey); found {
+		return filter, nil
+	}
+
+	opts := append(c.opts[:len(c.opts):len(c.opts)], WithNow(now))
+	filter, err := Compile(env, filters, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if filter.callsNow {
+		key = nowKey
+	}
+	c.add(key, filter)
+	return filter, nil
+}
+
+func (c *Cache) get(key cacheKey) (*Filter, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, found := c.entries[key]
+	if !found {
+		return nil, false
+	}
+	c.recent.MoveToFront(element)
+	return element.Value.(*cacheEntry).filter, true
+}
+
+func (c *Cache) add(key cacheKey, filter *Filter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// The filter may have been compiled concurrently.
+	if element, found := c.entries[key]; found {
+		c.recent.MoveToFront(element)
+		return
+	}
+	if c.size <= 0 {
+		return
+	}
+	for c.recent.Len() >= c.size {
+		oldest := c.recent.Back()
+		c.recent.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+	c.entries[key] = c.recent.PushFront(&cacheEntry{key, filter})
+}
+
+// Len returns the number of cached filters.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.recent.Len()
+}
@@ -0,0 +1,138 @@
+package cel2sql
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"cel2sql/cel"
+)
+
+func TestCache(t *testing.T) {
+	env, err := cel.NewRecordsEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := NewCache(2, WithLimits(Limits{MaxNodes: 10}))
+
+	first, err := cache.Compile(env, `name == "a"`, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("cached filter", func(t *testing.T) {
+		got, err := cache.Compile(env, `name == "a"`, time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != first {
+			t.Error("Want the cached filter, but got a new one")
+		}
+	})
+
+	t.Run("filters at another instant", func(t *testing.T) {
+		got, err := cache.Compile(env, `name == "a"`, time.Date(2023, 1, 16, 10, 0, 0, 0, time.UTC))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != first {
+			t.Error("Want the cached filter, since it doesn't call now(), but got a new one")
+		}
+	})
+
+	t.Run("least recently used filters are evicted", func(t *testing.T) {
+		for _, filter := range []string{`name == "b"`, `name == "c"`} {
+			if _, err := cache.Compile(env, filter, time.Time{}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got := cache.Len(); got != 2 {
+			t.Errorf("Want 2 cached filters, but got %d", got)
+		}
+
+		got, err := cache.Compile(env, `name == "a"`, time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got == first {
+			t.Error("Want a new filter, but got the evicted one")
+		}
+	})
+
+	t.Run("options", func(t *testing.T) {
+		_, err := cache.Compile(env, `name == "a" || name == "b" || name == "c"`, time.Time{})
+		if !errors.Is(err, ErrFilterTooComplex) {
+			t.Errorf("Want ErrFilterTooComplex, but got %v", err)
+		}
+	})
+
+	t.Run("concurrent use", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for k := 0; k < 8; k++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for _, filter := range []string{`name == "a"`, `name == "b"`, `name == "c"`} {
+					if _, err := cache.Compile(env, filter, time.Time{}); err != nil {
+						t.Error(err)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		if got := cache.Len(); got != 2 {
+			t.Errorf("Want 2 cached filters, but got %d", got)
+		}
+	})
+}
+
+func TestCacheNow(t *testing.T) {
+	env, err := cel.NewRecordsEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := NewCache(10)
+
+	const expr = `data.status.completionTime > now() - duration("1h")`
+	now := time.Date(2023, 1, 16, 10, 0, 0, 0, time.UTC)
+	first, err := cache.Compile(env, expr, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("same instant in another location", func(t *testing.T) {
+		got, err := cache.Compile(env, expr, now.In(time.FixedZone("CET", 3600)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != first {
+			t.Error("Want the filter cached for the same instant, but got a new one")
+		}
+	})
+
+	t.Run("another instant", func(t *testing.T) {
+		got, err := cache.Compile(env, expr, now.Add(time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got == first {
+			t.Error("Want a new filter, but got the one cached for another instant")
+		}
+	})
+
+	t.Run("current time of the database", func(t *testing.T) {
+		current, err := cache.Compile(env, expr, time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := cache.Compile(env, expr, now.Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got == current {
+			t.Error("Want a new filter, but got the one referring to the current time of the database")
+		}
+	})
+}
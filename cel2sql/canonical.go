@@ -0,0 +1,172 @@
+package cel2sql
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/operators"
+	"github.com/google/cel-go/parser"
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// Canonicalize returns the canonical form of the CEL expression, which is the
+// same for the expressions that only differ in whitespace, comments, redundant
+// parentheses, the quoting of literals or the order of the operands of chains
+// of && and || operators. Since those operators are commutative in CEL, even
+// when their operands yield errors, expressions with the same canonical form
+// are equivalent.
+func Canonicalize(env *cel.Env, filters string) (string, error) {
+	// The macros are unparsed from the calls tracked by the parser.
+	env, err := env.Extend(cel.EnableMacroCallTracking())
+	if err != nil {
+		return "", err
+	}
+	ast, issues := env.Parse(filters)
+	if issues != nil && issues.Err() != nil {
+		return "", fmt.Errorf("error parsing CEL filters: %w", issues.Err())
+	}
+	parsedExpr, err := cel.AstToParsedExpr(ast)
+	if err != nil {
+		return "", err
+	}
+
+	c := &canonicalizer{sourceInfo: parsedExpr.GetSourceInfo()}
+	expr, err := c.canonicalize(parsedExpr.GetExpr())
+	if err != nil {
+		return "", err
+	}
+	return c.unparse(expr)
+}
+
+// canonicalizer sorts the operands of the chains of && and || operators of a
+// parsed CEL expression.
+type canonicalizer struct {
+	sourceInfo *exprpb.SourceInfo
+}
+
+// canonicalize returns the canonical form of the provided expression. Its
+// subexpressions are canonicalized in place. Macros are unparsed from the
+// calls recorded in the source info, rather than from their expansion, so
+// these are the ones canonicalized.
+func (c *canonicalizer) canonicalize(expr *exprpb.Expr) (*exprpb.Expr, error) {
+	if macro, found := c.sourceInfo.GetMacroCalls()[expr.GetId()]; found {
+		if _, err := c.canonicalize(macro); err != nil {
+			return nil, err
+		}
+		return expr, nil
+	}
+
+	switch node := expr.GetExprKind().(type) {
+	case *exprpb.Expr_SelectExpr:
+		operand, err := c.canonicalize(node.SelectExpr.GetOperand())
+		if err != nil {
+			return nil, err
+		}
+		node.SelectExpr.Operand = operand
+
+	case *exprpb.Expr_CallExpr:
+		if target := node.CallExpr.GetTarget(); target != nil {
+			target, err := c.canonicalize(target)
+			if err != nil {
+				return nil, err
+			}
+			node.CallExpr.Target = target
+		}
+		if function := node.CallExpr.GetFunction(); function == operators.LogicalAnd || function == operators.LogicalOr {
+			return c.canonicalizeChain(expr, function)
+		}
+		for k, arg := range node.CallExpr.GetArgs() {
+			arg, err := c.canonicalize(arg)
+			if err != nil {
+				return nil, err
+			}
+			node.CallExpr.Args[k] = arg
+		}
+
+	case *exprpb.Expr_ListExpr:
+		for k, element := range node.ListExpr.GetElements() {
+			element, err := c.canonicalize(element)
+			if err != nil {
+				return nil, err
+			}
+			node.ListExpr.Elements[k] = element
+		}
+
+	case *exprpb.Expr_StructExpr:
+		for _, entry := range node.StructExpr.GetEntries() {
+			if key := entry.GetMapKey(); key != nil {
+				key, err := c.canonicalize(key)
+				if err != nil {
+					return nil, err
+				}
+				entry.KeyKind = &exprpb.Expr_CreateStruct_Entry_MapKey{MapKey: key}
+			}
+			value, err := c.canonicalize(entry.GetValue())
+			if err != nil {
+				return nil, err
+			}
+			entry.Value = value
+		}
+	}
+	return expr, nil
+}
+
+// canonicalizeChain flattens the chain of the provided logical operator, which
+// the parser balances, and rebuilds it as a left-associative chain of its
+// canonical operands sorted by their unparsed form.
+func (c *canonicalizer) canonicalizeChain(expr *exprpb.Expr, function string) (*exprpb.Expr, error) {
+	ids, operands := c.chainOf(expr, function, nil, nil)
+
+	type operand struct {
+		expr *exprpb.Expr
+		text string
+	}
+	sorted := make([]operand, 0, len(operands))
+	for _, expr := range operands {
+		expr, err := c.canonicalize(expr)
+		if err != nil {
+			return nil, err
+		}
+		text, err := c.unparse(expr)
+		if err != nil {
+			return nil, err
+		}
+		sorted = append(sorted, operand{expr, text})
+	}
+	sort.SliceStable(sorted, func(a, b int) bool {
+		return sorted[a].text < sorted[b].text
+	})
+
+	chain := sorted[0].expr
+	for k, operand := range sorted[1:] {
+		chain = &exprpb.Expr{
+			Id: ids[k],
+			ExprKind: &exprpb.Expr_CallExpr{CallExpr: &exprpb.Expr_Call{
+				Function: function,
+				Args:     []*exprpb.Expr{chain, operand.expr},
+			}},
+		}
+	}
+	return chain, nil
+}
+
+// chainOf appends the IDs of the calls to the logical operator and the operands
+// of the chain rooted at the provided expression.
+func (c *canonicalizer) chainOf(expr *exprpb.Expr, function string, ids []int64, operands []*exprpb.Expr) ([]int64, []*exprpb.Expr) {
+	_, isMacro := c.sourceInfo.GetMacroCalls()[expr.GetId()]
+	if call := expr.GetCallExpr(); !isMacro && call.GetFunction() == function && len(call.GetArgs()) == 2 {
+		ids = append(ids, expr.GetId())
+		for _, arg := range call.GetArgs() {
+			ids, operands = c.chainOf(arg, function, ids, operands)
+		}
+		return ids, operands
+	}
+	return ids, append(operands, expr)
+}
+
+// unparse returns the provided expression on a single line.
+func (c *canonicalizer) unparse(expr *exprpb.Expr) (string, error) {
+	return parser.Unparse(expr, c.sourceInfo, parser.WrapOnColumn(math.MaxInt32))
+}
@@ -0,0 +1,82 @@
+package cel2sql
+
+import (
+	"testing"
+
+	"cel2sql/cel"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCanonicalize(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []string
+		want string
+	}{{
+		name: "whitespace, comments and quotes",
+		in: []string{
+			`name=='foo'`,
+			"name == \"foo\" // the name\n",
+		},
+		want: `name == "foo"`,
+	},
+		{
+			name: "commutative operands",
+			in: []string{
+				`name == "a" && (data_type == "x" || name == "c")`,
+				`(name == "c" || data_type == "x") && name == "a"`,
+			},
+			want: `(data_type == "x" || name == "c") && name == "a"`,
+		},
+		{
+			name: "chains of operators",
+			in: []string{
+				`name == "a" && name == "b" && name == "c" && name == "d"`,
+				`(name == "d" && name == "b") && (name == "c" && name == "a")`,
+			},
+			want: `name == "a" && name == "b" && name == "c" && name == "d"`,
+		},
+		{
+			name: "macros",
+			in: []string{
+				`data.x.exists(e, e.y == 1 && e.z == 2) && has(data.status)`,
+				`has(data.status) && data.x.exists(e, e.z == 2 && e.y == 1)`,
+			},
+			want: `data.x.exists(e, e.y == 1 && e.z == 2) && has(data.status)`,
+		},
+		{
+			name: "non-commutative operators",
+			in: []string{
+				`"b" + name == "ba"`,
+			},
+			want: `"b" + name == "ba"`,
+		},
+	}
+
+	env, err := cel.NewRecordsEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, in := range test.in {
+				got, err := Canonicalize(env, in)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if diff := cmp.Diff(test.want, got); diff != "" {
+					t.Errorf("Mismatch for %q (-want +got):\n%s", in, diff)
+				}
+			}
+		})
+	}
+
+	t.Run("syntax error", func(t *testing.T) {
+		if _, err := Canonicalize(env, `name ==`); err == nil {
+			t.Error("Want error, but got nil")
+		}
+	})
+}
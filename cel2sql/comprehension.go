@@ -0,0 +1,133 @@
+package cel2sql
+
+import (
+	"fmt"
+
+	"github.com/google/cel-go/common/operators"
+	"github.com/google/cel-go/parser"
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// interpretComprehensionExpr translates the exists, all and exists_one macros
+// over dyn JSON arrays into SQL subqueries that iterate over the elements of
+// the array. The iteration variable is bound to each jsonb element of the
+// array, so that field selections on it become JSON accessors. Elements are
+// aliased after the nesting depth of the comprehension rather than after the
+// iteration variable, which may be a SQL keyword, such as order.
+func (i *interpreter) interpretComprehensionExpr(id int64, expr *exprpb.Expr_ComprehensionExpr) (sqlExpr, error) {
+	comprehension := expr.ComprehensionExpr
+	macro, predicate := quantifierOf(comprehension)
+	if macro == "" {
+		return nil, i.unsupportedExprError(id, "comprehension")
+	}
+
+	elements, err := i.interpretIterRange(comprehension.GetIterRange())
+	if err != nil {
+		return nil, err
+	}
+	alias := fmt.Sprintf("element%d", len(i.iterVars)+1)
+
+	i.iterVars = append(i.iterVars, iterVar{comprehension.GetIterVar(), alias})
+	defer func() {
+		i.iterVars = i.iterVars[:len(i.iterVars)-1]
+	}()
+
+	condition, err := i.interpretExpr(predicate)
+	if err != nil {
+		return nil, err
+	}
+
+	switch macro {
+	case operators.Exists:
+		return unaryExpr{"EXISTS", subquery{raw{"1"}, elements, alias, condition}}, nil
+
+	case operators.All:
+		// Elements for which the predicate isn't true (including the ones for
+		// which it yields NULL) are counterexamples.
+		counterexample := postfixExpr{paren{condition}, "IS NOT TRUE"}
+		return unaryExpr{"NOT", unaryExpr{"EXISTS", subquery{raw{"1"}, elements, alias, counterexample}}}, nil
+
+	default:
+		return binaryExpr{"=", subquery{raw{"count(*)"}, elements, alias, condition}, raw{"1"}}, nil
+	}
+}
+
+// interpretIterRange translates the JSON array being iterated over.
+func (i *interpreter) interpretIterRange(iterRange *exprpb.Expr) (sqlExpr, error) {
+	if !i.isDyn(iterRange) {
+		return nil, i.unsupportedExprError(iterRange.GetId(), "iteration range")
+	}
+	return i.interpretJSONExpr(iterRange)
+}
+
+// quantifierOf inspects the comprehension generated by the expansion of one of
+// the exists, all or exists_one macros and returns the macro name along with
+// the predicate applied to each element. It returns an empty name if the
+// comprehension doesn't match any of the supported macros.
+func quantifierOf(comprehension *exprpb.Expr_Comprehension) (string, *exprpb.Expr) {
+	if comprehension.GetAccuVar() != parser.AccumulatorName {
+		return "", nil
+	}
+
+	step := comprehension.GetLoopStep().GetCallExpr()
+	if step == nil {
+		return "", nil
+	}
+	init := comprehension.GetAccuInit().GetConstExpr()
+	args := step.GetArgs()
+
+	switch step.GetFunction() {
+	case operators.LogicalOr:
+		if _, ok := init.GetConstantKind().(*exprpb.Constant_BoolValue); ok && !init.GetBoolValue() {
+			return operators.Exists, args[1]
+		}
+
+	case operators.LogicalAnd:
+		if _, ok := init.GetConstantKind().(*exprpb.Constant_BoolValue); ok && init.GetBoolValue() {
+			return operators.All, args[1]
+		}
+
+	case operators.Conditional:
+		if _, ok := init.GetConstantKind().(*exprpb.Constant_Int64Value); ok {
+			return operators.ExistsOne, args[0]
+		}
+	}
+	return "", nil
+}
+
+// iterVar is the iteration variable of a comprehension, along with the SQL
+// alias bound to the elements it iterates over.
+type iterVar struct {
+	name  string
+	alias string
+}
+
+// iterVarAlias returns the SQL alias bound to the provided iteration variable
+// of a comprehension being interpreted. Inner comprehensions shadow the
+// variables of the outer ones.
+func (i *interpreter) iterVarAlias(name string) (string, bool) {
+	for index := len(i.iterVars) - 1; index >= 0; index-- {
+		if i.iterVars[index].name == name {
+			return i.iterVars[index].alias, true
+		}
+	}
+	return "", false
+}
+
+// isIterVar returns true if the provided name refers to the iteration variable
+// of a comprehension being interpreted.
+func (i *interpreter) isIterVar(name string) bool {
+	_, ok := i.iterVarAlias(name)
+	return ok
+}
+
+// isIterAlias returns true if the provided name is the SQL alias bound to the
+// iteration variable of a comprehension being interpreted.
+func (i *interpreter) isIterAlias(name string) bool {
+	for _, iterVar := range i.iterVars {
+		if iterVar.alias == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package cel2sql
+
+import (
+	"math"
+
+	"github.com/google/cel-go/common/operators"
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// mayBeTranslatedIntoJSONPathContainsExpression returns true if the equality
+// of arg1 and arg2 can be translated into a JSON containment check, which
+// allows the database to use indexes over whole JSON documents, such as the
+// GIN indexes of Postgres. Such is the case when arg2 is a constant JSON scalar
+// and arg1 selects a value of a JSON column, either by navigating a chain of
+// keys of a dyn value, as in data.metadata.labels["app"], or by indexing a map,
+// as in annotations["repo"].
+func (i *interpreter) mayBeTranslatedIntoJSONPathContainsExpression(arg1 *exprpb.Expr, function string, arg2 *exprpb.Expr) bool {
+	if !i.jsonContainment || function != operators.Equals {
+		return false
+	}
+	if _, ok := i.dialect.(JSONContainmentDialect); !ok {
+		return false
+	}
+	value, ok := jsonScalarOf(arg2)
+	if !ok {
+		return false
+	}
+
+	if isIndexExpr(arg1) && i.isMap(arg1.GetCallExpr().Args[0]) {
+		_, isKey := arg1.GetCallExpr().Args[1].GetConstExpr().GetConstantKind().(*exprpb.Constant_StringValue)
+		_, isString := value.(string)
+		return isKey && isString
+	}
+
+	_, _, ok = i.jsonObjectPathOf(arg1)
+	return ok
+}
+
+func (i *interpreter) translateIntoJSONPathContainsExpression(arg1 *exprpb.Expr, arg2 *exprpb.Expr) (sqlExpr, error) {
+	value, _ := jsonScalarOf(arg2)
+
+	if isIndexExpr(arg1) && i.isMap(arg1.GetCallExpr().Args[0]) {
+		callExprArgs := arg1.GetCallExpr().GetArgs()
+		column, err := i.interpretExpr(callExprArgs[0])
+		if err != nil {
+			return nil, err
+		}
+		key := callExprArgs[1].GetConstExpr().GetStringValue()
+		return jsonContains{document: column, candidate: map[string]any{key: value}}, nil
+	}
+
+	root, keys, _ := i.jsonObjectPathOf(arg1)
+	candidate := value
+	for k := len(keys) - 1; k >= 0; k-- {
+		candidate = map[string]any{keys[k]: candidate}
+	}
+	return jsonContains{document: column{root}, candidate: candidate}, nil
+}
+
+// jsonObjectPathOf returns the column and the keys navigated by the provided
+// chain of field selections and index operations over a dyn column, as long as
+// all of them select keys of JSON objects. Array indices aren't supported,
+// since containment checks can't tell the position of array elements apart.
+// Neither are iteration variables, which aren't backed by indexed columns.
+func (i *interpreter) jsonObjectPathOf(expr *exprpb.Expr) (string, []string, bool) {
+	if expr.GetSelectExpr() == nil && !isIndexExpr(expr) || !i.isDyn(expr) {
+		return "", nil, false
+	}
+	root, path, err := i.jsonPathOf(expr)
+	if err != nil || i.isIterAlias(root) {
+		return "", nil, false
+	}
+
+	keys := make([]string, 0, len(path))
+	for _, elem := range path {
+		if elem.IsIndex {
+			return "", nil, false
+		}
+		keys = append(keys, elem.Key)
+	}
+	return root, keys, true
+}
+
+// jsonScalarOf returns the value of the provided expression if it's a constant
+// that can be represented as a JSON scalar: a string, a finite number or a
+// boolean.
+func jsonScalarOf(expr *exprpb.Expr) (any, bool) {
+	switch constant := expr.GetConstExpr().GetConstantKind().(type) {
+	case *exprpb.Constant_StringValue:
+		return constant.StringValue, true
+
+	case *exprpb.Constant_Int64Value:
+		return constant.Int64Value, true
+
+	case *exprpb.Constant_Uint64Value:
+		return constant.Uint64Value, true
+
+	case *exprpb.Constant_DoubleValue:
+		if math.IsNaN(constant.DoubleValue) || math.IsInf(constant.DoubleValue, 0) {
+			return nil, false
+		}
+		return constant.DoubleValue, true
+
+	case *exprpb.Constant_BoolValue:
+		return constant.BoolValue, true
+	}
+	return nil, false
+}
@@ -0,0 +1,122 @@
+package cel2sql
+
+import (
+	"fmt"
+
+	"github.com/google/cel-go/checker"
+	"github.com/google/cel-go/common/overloads"
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// Patterns of the strings accepted by the CEL conversion functions. Strings
+// are matched against them before being cast, so that values which can't be
+// converted yield NULL instead of failing the whole query, much like
+// conversion errors make CEL filters not match. Backslashes are avoided, since
+// MySQL would treat them as escape sequences in string literals.
+const (
+	intPattern      = `^[+-]?[0-9]+$`
+	uintPattern     = `^[+]?[0-9]+$`
+	doublePattern   = `^[+-]?([0-9]+([.][0-9]*)?|[.][0-9]+)([eE][+-]?[0-9]+)?$`
+	durationPattern = `^([0-9]+([.][0-9]*)?(ms|h|m|s))+$`
+)
+
+// Strings accepted by the bool conversion function.
+var (
+	trueStrings  = []sqlExpr{literal{"1"}, literal{"t"}, literal{"true"}, literal{"TRUE"}, literal{"True"}}
+	falseStrings = []sqlExpr{literal{"0"}, literal{"f"}, literal{"false"}, literal{"FALSE"}, literal{"False"}}
+)
+
+// interpretConversionFunction translates the int, uint, double, string, bool
+// and duration conversion functions. Strings and dyn values are converted
+// from their text representation.
+func (i *interpreter) interpretConversionFunction(id int64, expr *exprpb.Expr_CallExpr) (sqlExpr, error) {
+	function := expr.CallExpr.GetFunction()
+	argExpr := expr.CallExpr.Args[0]
+	if function == overloads.TypeConvertDuration && argExpr.GetConstExpr() != nil {
+		duration, err := i.durationOf(&exprpb.Expr{Id: id, ExprKind: expr})
+		if err != nil {
+			return nil, err
+		}
+		return interval{duration}, nil
+	}
+
+	arg, err := i.interpretExpr(argExpr)
+	if err != nil {
+		return nil, err
+	}
+	from := i.checkedExpr.TypeMap[argExpr.GetId()]
+	fromText := i.isDyn(argExpr) || from.GetPrimitive() == exprpb.Type_STRING
+
+	switch function {
+	case overloads.TypeConvertInt:
+		switch {
+		case fromText:
+			return convertText(arg, intPattern, IntType), nil
+		case from.GetPrimitive() == exprpb.Type_DOUBLE:
+			return cast{call{truncateFunc, []sqlExpr{arg}}, IntType}, nil
+		case from.GetPrimitive() == exprpb.Type_INT64, from.GetPrimitive() == exprpb.Type_UINT64:
+			return arg, nil
+		}
+
+	case overloads.TypeConvertUint:
+		switch {
+		case fromText:
+			return convertText(arg, uintPattern, IntType), nil
+		case from.GetPrimitive() == exprpb.Type_DOUBLE:
+			return cast{call{truncateFunc, []sqlExpr{arg}}, IntType}, nil
+		case from.GetPrimitive() == exprpb.Type_INT64, from.GetPrimitive() == exprpb.Type_UINT64:
+			return arg, nil
+		}
+
+	case overloads.TypeConvertDouble:
+		switch {
+		case fromText:
+			return convertText(arg, doublePattern, DoubleType), nil
+		case from.GetPrimitive() == exprpb.Type_INT64, from.GetPrimitive() == exprpb.Type_UINT64:
+			return cast{arg, DoubleType}, nil
+		case from.GetPrimitive() == exprpb.Type_DOUBLE:
+			return arg, nil
+		}
+
+	case overloads.TypeConvertString:
+		switch {
+		case i.isDyn(argExpr):
+			// The text of JSON numbers isn't necessarily a string in every
+			// dialect.
+			return cast{arg, StringType}, nil
+		case fromText:
+			return arg, nil
+		case from.GetPrimitive() == exprpb.Type_BOOL:
+			return caseExpr{arg, literal{"true"}, literal{"false"}}, nil
+		case from.GetPrimitive() == exprpb.Type_INT64, from.GetPrimitive() == exprpb.Type_UINT64, from.GetPrimitive() == exprpb.Type_DOUBLE:
+			return cast{arg, StringType}, nil
+		}
+
+	case overloads.TypeConvertBool:
+		switch {
+		case fromText:
+			return caseExpr{
+				binaryExpr{"IN", arg, list{trueStrings}},
+				literal{true},
+				caseExpr{binaryExpr{"IN", arg, list{falseStrings}}, literal{false}, literal{nil}},
+			}, nil
+		case from.GetPrimitive() == exprpb.Type_BOOL:
+			return arg, nil
+		}
+
+	case overloads.TypeConvertDuration:
+		switch {
+		case fromText:
+			return convertText(arg, durationPattern, DurationType), nil
+		case from.GetWellKnown() == exprpb.Type_DURATION:
+			return arg, nil
+		}
+	}
+	return nil, i.unsupportedExprError(id, fmt.Sprintf("`%s` function with a %s argument", function, checker.FormatCheckedType(from)))
+}
+
+// convertText casts the text to the SQL type if it matches the pattern of the
+// values of that type, or yields NULL otherwise.
+func convertText(text sqlExpr, pattern string, to SQLType) sqlExpr {
+	return caseExpr{call{matchesFunc, []sqlExpr{text, literal{pattern}}}, cast{text, to}, literal{nil}}
+}
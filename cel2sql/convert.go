@@ -6,18 +6,72 @@ import (
 	"github.com/google/cel-go/cel"
 )
 
-// Convert takes CEL expressions and attempt to convert them into Postgres SQL
-// filters.
-func Convert(env *cel.Env, filters string) (string, error) {
+// Convert takes CEL expressions and attempt to convert them into SQL filters in
+// the configured dialect (Postgres by default). Literal values are inlined into
+// the returned SQL as properly escaped SQL literals. Prefer ConvertWithVars when
+// the SQL is going to be sent to the database.
+//
+// Comparisons with null keep the semantics of CEL, whereas comparing anything
+// with NULL in SQL yields NULL: x == null and x != null are translated into
+// IS NULL and IS NOT NULL checks. Values selected from JSON documents are
+// compared with explicit JSON nulls instead, so a missing key neither equals
+// null nor differs from it, much like CEL fails to evaluate the comparison
+// when the key doesn't exist. The has() macro checks whether a key exists.
+func Convert(env *cel.Env, filters string, opts ...Option) (string, error) {
+	interpreter, err := compile(env, filters, opts...)
+	if err != nil {
+		return "", err
+	}
+
+	return interpreter.interpret()
+}
+
+// ConvertWithVars takes CEL expressions and attempt to convert them into
+// parameterized SQL filters in the configured dialect. Literal values, JSON keys
+// and JSON documents are replaced with placeholders in the returned SQL and the
+// values bound to them are returned in the same order as the placeholders
+// appear. Comparisons with null are translated as described in Convert.
+func ConvertWithVars(env *cel.Env, filters string, opts ...Option) (string, []any, error) {
+	interpreter, err := compile(env, filters, opts...)
+	if err != nil {
+		return "", nil, err
+	}
+	interpreter.parameterize = true
+
+	sql, err := interpreter.interpret()
+	if err != nil {
+		return "", nil, err
+	}
+	return sql, interpreter.vars, nil
+}
+
+// compile compiles the CEL expressions and returns an interpreter ready to
+// convert them.
+func compile(env *cel.Env, filters string, opts ...Option) (*interpreter, error) {
 	ast, issues := env.Compile(filters)
 	if issues != nil && issues.Err() != nil {
-		return "", fmt.Errorf("error compiling CEL filters: %w", issues.Err())
+		return nil, fmt.Errorf("error compiling CEL filters: %w", issues.Err())
 	}
 
 	interpreter, err := newInterpreter(ast)
 	if err != nil {
-		return "", fmt.Errorf("error creating cel2sql interpreter: %w", err)
+		return nil, fmt.Errorf("error creating cel2sql interpreter: %w", err)
 	}
 
-	return interpreter.interpret()
+	for _, opt := range opts {
+		opt(interpreter)
+	}
+	// The size of the AST is checked before folding it, so that oversized
+	// expressions are rejected early. The limits don't bound the evaluation
+	// of the closed subexpressions, whose cost doesn't grow with the size of
+	// the AST, but the folder has a budget of its own.
+	interpreter.cost.measureAST(interpreter.checkedExpr.Expr, 1)
+	if err := interpreter.limits.check(interpreter.cost); err != nil {
+		return nil, err
+	}
+	interpreter.checkedExpr, err = foldConstants(env, interpreter.checkedExpr, interpreter.functions)
+	if err != nil {
+		return nil, err
+	}
+	return interpreter, nil
 }
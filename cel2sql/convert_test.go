@@ -1,97 +1,554 @@
 package cel2sql
 
 import (
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"cel2sql/cel"
 
+	celgo "github.com/google/cel-go/cel"
 	"github.com/google/go-cmp/cmp"
+	resultspb "github.com/tektoncd/results/proto/v1alpha2/results_go_proto"
+	"gorm.io/gorm"
+	"gorm.io/gorm/utils/tests"
 )
 
 func TestConvertRecordExpressions(t *testing.T) {
 	tests := []struct {
-		name string
-		in   string
-		want string
+		name      string
+		in        string
+		want      string
+		wantMySQL string
 	}{{
-		name: "simple expression",
-		in:   `name == "foo"`,
-		want: "name = 'foo'",
+		name:      "simple expression",
+		in:        `name == "foo"`,
+		want:      "name = 'foo'",
+		wantMySQL: `name = 'foo'`,
 	},
 		{
-			name: "select expression",
-			in:   `data.metadata.namespace == "default"`,
-			want: "(data->'metadata'->>'namespace') = 'default'",
+			name:      "select expression",
+			in:        `data.metadata.namespace == "default"`,
+			want:      `data @> '{"metadata":{"namespace":"default"}}'::jsonb`,
+			wantMySQL: `(JSON_UNQUOTE(JSON_EXTRACT(data, '$."metadata"."namespace"'))) = 'default'`,
+		},
+		{
+			name:      "type coercion with a dyn expression in the left hand side",
+			in:        `data.status.completionTime > timestamp("2022/10/30T21:45:00.000Z")`,
+			want:      "(data->'status'->>'completionTime')::TIMESTAMP WITH TIME ZONE > '2022/10/30T21:45:00.000Z'::TIMESTAMP WITH TIME ZONE",
+			wantMySQL: `CAST((JSON_UNQUOTE(JSON_EXTRACT(data, '$."status"."completionTime"'))) AS DATETIME) > CAST('2022/10/30T21:45:00.000Z' AS DATETIME)`,
+		},
+		{
+			name:      "type coercion with a dyn expression in the right hand side",
+			in:        `timestamp("2022/10/30T21:45:00.000Z") < data.status.completionTime`,
+			want:      "'2022/10/30T21:45:00.000Z'::TIMESTAMP WITH TIME ZONE < (data->'status'->>'completionTime')::TIMESTAMP WITH TIME ZONE",
+			wantMySQL: `CAST('2022/10/30T21:45:00.000Z' AS DATETIME) < CAST((JSON_UNQUOTE(JSON_EXTRACT(data, '$."status"."completionTime"'))) AS DATETIME)`,
+		},
+		{
+			name:      "type coercion to integers",
+			in:        `data.spec.timeouts.retries > 3`,
+			want:      "(data->'spec'->'timeouts'->>'retries')::BIGINT > 3",
+			wantMySQL: `CAST((JSON_UNQUOTE(JSON_EXTRACT(data, '$."spec"."timeouts"."retries"'))) AS SIGNED) > 3`,
+		},
+		{
+			name:      "type coercion to doubles",
+			in:        `1.5 <= data.spec.ratio`,
+			want:      "1.5 <= (data->'spec'->>'ratio')::DOUBLE PRECISION",
+			wantMySQL: `1.5 <= CAST((JSON_UNQUOTE(JSON_EXTRACT(data, '$."spec"."ratio"'))) AS DOUBLE)`,
+		},
+		{
+			name:      "type coercion to booleans",
+			in:        `data.spec.enabled != false`,
+			want:      "(data->'spec'->>'enabled')::BOOLEAN <> FALSE",
+			wantMySQL: `((JSON_UNQUOTE(JSON_EXTRACT(data, '$."spec"."enabled"'))) = 'true') <> FALSE`,
+		},
+		{
+			name:      "scalars compared with JSON arrays",
+			in:        `data.spec.workspaces == "source"`,
+			want:      `data @> '{"spec":{"workspaces":"source"}}'::jsonb`,
+			wantMySQL: `(JSON_UNQUOTE(JSON_EXTRACT(data, '$."spec"."workspaces"'))) = 'source'`,
+		},
+		{
+			name:      "negated dyn values",
+			in:        `!data.spec.enabled`,
+			want:      "NOT (data->'spec'->>'enabled')::BOOLEAN",
+			wantMySQL: `NOT ((JSON_UNQUOTE(JSON_EXTRACT(data, '$."spec"."enabled"'))) = 'true')`,
+		},
+		{
+			name:      "dyn operands of logical operators",
+			in:        `data.spec.enabled && (data.spec.skipped || name == "foo")`,
+			want:      "(data->'spec'->>'enabled')::BOOLEAN AND ((data->'spec'->>'skipped')::BOOLEAN OR name = 'foo')",
+			wantMySQL: `((JSON_UNQUOTE(JSON_EXTRACT(data, '$."spec"."enabled"'))) = 'true') AND (((JSON_UNQUOTE(JSON_EXTRACT(data, '$."spec"."skipped"'))) = 'true') OR name = 'foo')`,
+		},
+		{
+			name:      "dyn conditions",
+			in:        `(data.spec.enabled ? name : data_type) == "foo"`,
+			want:      "CASE WHEN (data->'spec'->>'enabled')::BOOLEAN THEN name ELSE type END = 'foo'",
+			wantMySQL: `CASE WHEN ((JSON_UNQUOTE(JSON_EXTRACT(data, '$."spec"."enabled"'))) = 'true') THEN name ELSE type END = 'foo'`,
+		},
+		{
+			name:      "type coercion to durations",
+			in:        `data.spec.timeout > duration("1h")`,
+			want:      "(data->'spec'->>'timeout')::INTERVAL > '3600 SECONDS'::INTERVAL",
+			wantMySQL: `(COALESCE(REGEXP_REPLACE(REGEXP_SUBSTR((JSON_UNQUOTE(JSON_EXTRACT(data, '$."spec"."timeout"'))), '[0-9.]+h'), '[a-z].*', ''), 0) * 3600 + COALESCE(REGEXP_REPLACE(REGEXP_SUBSTR((JSON_UNQUOTE(JSON_EXTRACT(data, '$."spec"."timeout"'))), '[0-9.]+m([^s]|$)'), '[a-z].*', ''), 0) * 60 + COALESCE(REGEXP_REPLACE(REGEXP_SUBSTR((JSON_UNQUOTE(JSON_EXTRACT(data, '$."spec"."timeout"'))), '[0-9.]+s'), '[a-z].*', ''), 0) * 1 + COALESCE(REGEXP_REPLACE(REGEXP_SUBSTR((JSON_UNQUOTE(JSON_EXTRACT(data, '$."spec"."timeout"'))), '[0-9.]+ms'), '[a-z].*', ''), 0) * 0.001) > 3600`,
+		},
+		{
+			name:      "type coercion in the in operator",
+			in:        `data.spec.timeouts.retries in [1, 2]`,
+			want:      "(data->'spec'->'timeouts'->>'retries')::BIGINT IN (1, 2)",
+			wantMySQL: `CAST((JSON_UNQUOTE(JSON_EXTRACT(data, '$."spec"."timeouts"."retries"'))) AS SIGNED) IN (1, 2)`,
+		},
+		{
+			name:      "type coercion of function arguments",
+			in:        `data.metadata.name.substring(data.spec.offset) == "run"`,
+			want:      "substr((data->'metadata'->>'name'), ((data->'spec'->>'offset')::BIGINT + 1)) = 'run'",
+			wantMySQL: `SUBSTRING((JSON_UNQUOTE(JSON_EXTRACT(data, '$."metadata"."name"'))), (CAST((JSON_UNQUOTE(JSON_EXTRACT(data, '$."spec"."offset"'))) AS SIGNED) + 1)) = 'run'`,
+		},
+		{
+			name:      "JSON containment with numbers and booleans",
+			in:        `data.spec.timeouts.retries == 3 && 0.5 == data.spec.ratio && data.spec.enabled == false`,
+			want:      `data @> '{"spec":{"enabled":false,"ratio":0.5,"timeouts":{"retries":3}}}'::jsonb`,
+			wantMySQL: `CAST((JSON_UNQUOTE(JSON_EXTRACT(data, '$."spec"."timeouts"."retries"'))) AS SIGNED) = 3 AND 0.5 = CAST((JSON_UNQUOTE(JSON_EXTRACT(data, '$."spec"."ratio"'))) AS DOUBLE) AND ((JSON_UNQUOTE(JSON_EXTRACT(data, '$."spec"."enabled"'))) = 'true') = FALSE`,
+		},
+		{
+			name:      "repeated predicates",
+			in:        `name == "foo" && data.metadata.namespace != "ci" && name == "foo"`,
+			want:      "name = 'foo' AND (data->'metadata'->>'namespace') <> 'ci'",
+			wantMySQL: `name = 'foo' AND (JSON_UNQUOTE(JSON_EXTRACT(data, '$."metadata"."namespace"'))) <> 'ci'`,
+		},
+		{
+			name:      "JSON containment checks with conflicting values",
+			in:        `data.metadata.name == "foo" && data.metadata.namespace == "ci" && data.metadata.name == "bar"`,
+			want:      `data @> '{"metadata":{"name":"foo","namespace":"ci"}}'::jsonb AND data @> '{"metadata":{"name":"bar"}}'::jsonb`,
+			wantMySQL: `(JSON_UNQUOTE(JSON_EXTRACT(data, '$."metadata"."name"'))) = 'foo' AND (JSON_UNQUOTE(JSON_EXTRACT(data, '$."metadata"."namespace"'))) = 'ci' AND (JSON_UNQUOTE(JSON_EXTRACT(data, '$."metadata"."name"'))) = 'bar'`,
+		},
+		{
+			name:      "JSON containment checks in a disjunction",
+			in:        `name == "foo" || data.metadata.name == "foo" && data.metadata.labels["app"] == "bar"`,
+			want:      `name = 'foo' OR data @> '{"metadata":{"labels":{"app":"bar"},"name":"foo"}}'::jsonb`,
+			wantMySQL: `name = 'foo' OR (JSON_UNQUOTE(JSON_EXTRACT(data, '$."metadata"."name"'))) = 'foo' AND (JSON_UNQUOTE(JSON_EXTRACT(data, '$."metadata"."labels"."app"'))) = 'bar'`,
+		},
+		{
+			name:      "numeric negation",
+			in:        `-size(name) < -3`,
+			want:      "-char_length(name) < -3",
+			wantMySQL: `-CHAR_LENGTH(name) < -3`,
+		},
+		{
+			name:      "grouped arithmetic",
+			in:        `size(name) - (size(data_type) - 1) * 2 > 0`,
+			want:      "char_length(name) - (char_length(type) - 1) * 2 > 0",
+			wantMySQL: `CHAR_LENGTH(name) - (CHAR_LENGTH(type) - 1) * 2 > 0`,
+		},
+		{
+			name:      "comparison of a string function",
+			in:        `data.metadata.name.startsWith("foo") == (data_type == "bar")`,
+			want:      "((data->'metadata'->>'name') LIKE 'foo' || '%' ESCAPE '!') = (type = 'bar')",
+			wantMySQL: `((JSON_UNQUOTE(JSON_EXTRACT(data, '$."metadata"."name"'))) LIKE CONCAT('foo', '%') ESCAPE '!') = (type = 'bar')`,
+		},
+		{
+			name:      "in operator",
+			in:        `data.metadata.namespace in ["foo", "bar"]`,
+			want:      "(data->'metadata'->>'namespace') IN ('foo', 'bar')",
+			wantMySQL: `(JSON_UNQUOTE(JSON_EXTRACT(data, '$."metadata"."namespace"'))) IN ('foo', 'bar')`,
+		},
+		{
+			name:      "in operator with a JSON array",
+			in:        `"source" in data.spec.workspaces`,
+			want:      "'source' IN (SELECT element#>>'{}' FROM jsonb_array_elements((data->'spec'->'workspaces')) AS element)",
+			wantMySQL: `'source' IN (SELECT JSON_UNQUOTE(element) FROM JSON_TABLE((JSON_EXTRACT(data, '$."spec"."workspaces"')), '$[*]' COLUMNS (element JSON PATH '$')) AS element)`,
+		},
+		{
+			name:      "index operator",
+			in:        `data.metadata.labels["foo"] == "bar"`,
+			want:      `data @> '{"metadata":{"labels":{"foo":"bar"}}}'::jsonb`,
+			wantMySQL: `(JSON_UNQUOTE(JSON_EXTRACT(data, '$."metadata"."labels"."foo"'))) = 'bar'`,
+		},
+		{
+			name:      "index operator on a JSON array",
+			in:        `data.spec.params[0].value == "x"`,
+			want:      "(data->'spec'->'params'->0->>'value') = 'x'",
+			wantMySQL: `(JSON_UNQUOTE(JSON_EXTRACT(data, '$."spec"."params"[0]."value"'))) = 'x'`,
+		},
+		{
+			name:      "mixed select and index operators",
+			in:        `data.status.taskRuns["build"].status.podName != "build-pod"`,
+			want:      "(data->'status'->'taskRuns'->'build'->'status'->>'podName') <> 'build-pod'",
+			wantMySQL: `(JSON_UNQUOTE(JSON_EXTRACT(data, '$."status"."taskRuns"."build"."status"."podName"'))) <> 'build-pod'`,
+		},
+		{
+			name:      "select expression on the data field",
+			in:        `data.kind != "PipelineRun"`,
+			want:      "(data->>'kind') <> 'PipelineRun'",
+			wantMySQL: `(JSON_UNQUOTE(JSON_EXTRACT(data, '$."kind"'))) <> 'PipelineRun'`,
+		},
+		{
+			name:      "contains string function",
+			in:        `data.metadata.name.contains("foo")`,
+			want:      "POSITION('foo' IN (data->'metadata'->>'name')) <> 0",
+			wantMySQL: `LOCATE('foo' COLLATE utf8mb4_bin, (JSON_UNQUOTE(JSON_EXTRACT(data, '$."metadata"."name"')))) <> 0`,
+		},
+		{
+			name:      "contains string function with a non-constant substring",
+			in:        `data.metadata.name.contains(data.metadata.namespace)`,
+			want:      "POSITION((data->'metadata'->>'namespace') IN (data->'metadata'->>'name')) <> 0",
+			wantMySQL: `LOCATE((JSON_UNQUOTE(JSON_EXTRACT(data, '$."metadata"."namespace"'))) COLLATE utf8mb4_bin, (JSON_UNQUOTE(JSON_EXTRACT(data, '$."metadata"."name"')))) <> 0`,
+		},
+		{
+			name:      "endsWith string function",
+			in:        `data.metadata.name.endsWith("bar")`,
+			want:      "(data->'metadata'->>'name') LIKE '%' || 'bar' ESCAPE '!'",
+			wantMySQL: `(JSON_UNQUOTE(JSON_EXTRACT(data, '$."metadata"."name"'))) LIKE CONCAT('%', 'bar') ESCAPE '!'`,
+		},
+		{
+			name:      "getDate function",
+			in:        `data.status.completionTime.getDate() == 2`,
+			want:      "EXTRACT(DAY FROM (data->'status'->>'completionTime')::TIMESTAMP WITH TIME ZONE) = 2",
+			wantMySQL: `EXTRACT(DAY FROM CAST((JSON_UNQUOTE(JSON_EXTRACT(data, '$."status"."completionTime"'))) AS DATETIME)) = 2`,
+		},
+		{
+			name:      "getDayOfMonth function",
+			in:        `data.status.completionTime.getDayOfMonth() == 2`,
+			want:      "(EXTRACT(DAY FROM (data->'status'->>'completionTime')::TIMESTAMP WITH TIME ZONE) - 1) = 2",
+			wantMySQL: `(EXTRACT(DAY FROM CAST((JSON_UNQUOTE(JSON_EXTRACT(data, '$."status"."completionTime"'))) AS DATETIME)) - 1) = 2`,
+		},
+		{
+			name:      "getDayOfWeek function",
+			in:        `data.status.completionTime.getDayOfWeek() > 0`,
+			want:      "EXTRACT(DOW FROM (data->'status'->>'completionTime')::TIMESTAMP WITH TIME ZONE) > 0",
+			wantMySQL: `(DAYOFWEEK(CAST((JSON_UNQUOTE(JSON_EXTRACT(data, '$."status"."completionTime"'))) AS DATETIME)) - 1) > 0`,
+		},
+		{
+			name:      "getDayOfYear function",
+			in:        `data.status.completionTime.getDayOfYear() > 15`,
+			want:      "(EXTRACT(DOY FROM (data->'status'->>'completionTime')::TIMESTAMP WITH TIME ZONE) - 1) > 15",
+			wantMySQL: `(DAYOFYEAR(CAST((JSON_UNQUOTE(JSON_EXTRACT(data, '$."status"."completionTime"'))) AS DATETIME)) - 1) > 15`,
+		},
+		{
+			name:      "getFullYear function",
+			in:        `data.status.completionTime.getFullYear() >= 2022`,
+			want:      "EXTRACT(YEAR FROM (data->'status'->>'completionTime')::TIMESTAMP WITH TIME ZONE) >= 2022",
+			wantMySQL: `EXTRACT(YEAR FROM CAST((JSON_UNQUOTE(JSON_EXTRACT(data, '$."status"."completionTime"'))) AS DATETIME)) >= 2022`,
+		},
+		{
+			name:      "getMonth function",
+			in:        `data.status.completionTime.getMonth() == 9`,
+			want:      "(EXTRACT(MONTH FROM (data->'status'->>'completionTime')::TIMESTAMP WITH TIME ZONE) - 1) = 9",
+			wantMySQL: `(EXTRACT(MONTH FROM CAST((JSON_UNQUOTE(JSON_EXTRACT(data, '$."status"."completionTime"'))) AS DATETIME)) - 1) = 9`,
+		},
+		{
+			name:      "getHours function with a time zone",
+			in:        `data.status.completionTime.getHours("America/Sao_Paulo") < 8`,
+			want:      "EXTRACT(HOUR FROM ((data->'status'->>'completionTime')::TIMESTAMP WITH TIME ZONE AT TIME ZONE 'America/Sao_Paulo')) < 8",
+			wantMySQL: `EXTRACT(HOUR FROM CONVERT_TZ(CAST((JSON_UNQUOTE(JSON_EXTRACT(data, '$."status"."completionTime"'))) AS DATETIME), '+00:00', 'America/Sao_Paulo')) < 8`,
+		},
+		{
+			name:      "getMinutes function with a UTC offset",
+			in:        `data.status.completionTime.getMinutes("-03:30") == 15`,
+			want:      "EXTRACT(MINUTE FROM ((data->'status'->>'completionTime')::TIMESTAMP WITH TIME ZONE AT TIME ZONE '-03:30'::INTERVAL)) = 15",
+			wantMySQL: `EXTRACT(MINUTE FROM CONVERT_TZ(CAST((JSON_UNQUOTE(JSON_EXTRACT(data, '$."status"."completionTime"'))) AS DATETIME), '+00:00', '-03:30')) = 15`,
+		},
+		{
+			name:      "getSeconds function",
+			in:        `data.status.completionTime.getSeconds() == 0`,
+			want:      "floor(EXTRACT(SECOND FROM (data->'status'->>'completionTime')::TIMESTAMP WITH TIME ZONE)) = 0",
+			wantMySQL: `EXTRACT(SECOND FROM CAST((JSON_UNQUOTE(JSON_EXTRACT(data, '$."status"."completionTime"'))) AS DATETIME)) = 0`,
+		},
+		{
+			name:      "getMilliseconds function",
+			in:        `data.status.completionTime.getMilliseconds() > 500`,
+			want:      "mod(floor(EXTRACT(MILLISECONDS FROM (data->'status'->>'completionTime')::TIMESTAMP WITH TIME ZONE)), 1000) > 500",
+			wantMySQL: `FLOOR(EXTRACT(MICROSECOND FROM CAST((JSON_UNQUOTE(JSON_EXTRACT(data, '$."status"."completionTime"'))) AS DATETIME)) / 1000) > 500`,
+		},
+		{
+			name:      "matches function",
+			in:        `data.metadata.name.matches("^foo.*$")`,
+			want:      `(data->'metadata'->>'name') ~ '^foo[^\n]*$'`,
+			wantMySQL: `REGEXP_LIKE((JSON_UNQUOTE(JSON_EXTRACT(data, '$."metadata"."name"'))), '^foo[^\\n]*\\z')`,
+		},
+		{
+			name:      "startsWith string function",
+			in:        `data.metadata.name.startsWith("bar")`,
+			want:      "(data->'metadata'->>'name') LIKE 'bar' || '%' ESCAPE '!'",
+			wantMySQL: `(JSON_UNQUOTE(JSON_EXTRACT(data, '$."metadata"."name"'))) LIKE CONCAT('bar', '%') ESCAPE '!'`,
+		},
+		{
+			name:      "case-insensitive matches function",
+			in:        `data.metadata.name.matches("(?i)^ab\\d+")`,
+			want:      `(data->'metadata'->>'name') ~ '^[Aa][Bb][0-9]+'`,
+			wantMySQL: `REGEXP_LIKE((JSON_UNQUOTE(JSON_EXTRACT(data, '$."metadata"."name"'))), '^[Aa][Bb][0-9]+')`,
+		},
+		{
+			name:      "startsWith function with LIKE wildcards",
+			in:        `name.startsWith("50%_done!")`,
+			want:      "name LIKE '50!%!_done!!' || '%' ESCAPE '!'",
+			wantMySQL: `name LIKE CONCAT('50!%!_done!!', '%') ESCAPE '!'`,
+		},
+		{
+			name:      "endsWith function with a non-constant suffix",
+			in:        `name.endsWith(data_type)`,
+			want:      `name LIKE '%' || replace(replace(replace(type, '!', '!!'), '%', '!%'), '_', '!_') ESCAPE '!'`,
+			wantMySQL: `name LIKE CONCAT('%', REPLACE(REPLACE(REPLACE(type, '!', '!!'), '%', '!%'), '_', '!_')) ESCAPE '!'`,
+		},
+		{
+			name:      "constant arithmetic",
+			in:        `data.spec.retries == 1 + 2`,
+			want:      `data @> '{"spec":{"retries":3}}'::jsonb`,
+			wantMySQL: `CAST((JSON_UNQUOTE(JSON_EXTRACT(data, '$."spec"."retries"'))) AS SIGNED) = 3`,
+		},
+		{
+			name:      "constant string functions",
+			in:        `name == "a" + "b" && data_type != string(1 + 2)`,
+			want:      "name = 'ab' AND type <> '3'",
+			wantMySQL: "name = 'ab' AND type <> '3'",
+		},
+		{
+			name:      "logical operators with constant operands",
+			in:        `true && name == "foo" || false`,
+			want:      "name = 'foo'",
+			wantMySQL: "name = 'foo'",
+		},
+		{
+			name:      "logical operator decided by a constant operand",
+			in:        `false && name.matches(data_type)`,
+			want:      "FALSE",
+			wantMySQL: "FALSE",
+		},
+		{
+			name:      "conditional expression with a constant condition",
+			in:        `(size("abc") > 2 ? name : data_type) == "foo"`,
+			want:      "name = 'foo'",
+			wantMySQL: "name = 'foo'",
+		},
+		{
+			name:      "constant comprehension",
+			in:        `[1, 2, 3].exists(x, x > 2) && name == "foo"`,
+			want:      "name = 'foo'",
+			wantMySQL: "name = 'foo'",
+		},
+		{
+			name:      "trim function",
+			in:        `name.trim() == "foo"`,
+			want:      `btrim(name, E' \t\n\x0B\f\r') = 'foo'`,
+			wantMySQL: `REGEXP_REPLACE(name, '^[[:space:]]+|[[:space:]]+$', '') = 'foo'`,
+		},
+		{
+			name:      "replace function",
+			in:        `name.replace("-", "_") == "foo_bar"`,
+			want:      "replace(name, '-', '_') = 'foo_bar'",
+			wantMySQL: `REPLACE(name, '-', '_') = 'foo_bar'`,
+		},
+		{
+			name:      "substring function",
+			in:        `name.substring(4) == "bar"`,
+			want:      "substr(name, 5) = 'bar'",
+			wantMySQL: `SUBSTRING(name, 5) = 'bar'`,
+		},
+		{
+			name:      "substring function with a range",
+			in:        `name.substring(1, 3) == "oo"`,
+			want:      "substr(name, 2, 2) = 'oo'",
+			wantMySQL: `SUBSTRING(name, 2, 2) = 'oo'`,
+		},
+		{
+			name:      "substring function with a computed range",
+			in:        `name.substring(1, size(name) - 1) == "oo"`,
+			want:      "substr(name, 2, (char_length(name) - 1 - 1)) = 'oo'",
+			wantMySQL: `SUBSTRING(name, 2, (CHAR_LENGTH(name) - 1 - 1)) = 'oo'`,
+		},
+		{
+			name:      "indexOf function",
+			in:        `name.indexOf("-") == 3`,
+			want:      "(strpos(name, '-') - 1) = 3",
+			wantMySQL: `(LOCATE('-' COLLATE utf8mb4_bin, name) - 1) = 3`,
+		},
+		{
+			name:      "indexOf function with a start index",
+			in:        `name.indexOf("o", 2) == 2`,
+			want:      "CASE WHEN strpos(substr(name, 3), 'o') = 0 THEN -1 ELSE (strpos(substr(name, 3), 'o') + 1) END = 2",
+			wantMySQL: `CASE WHEN LOCATE('o' COLLATE utf8mb4_bin, SUBSTRING(name, 3)) = 0 THEN -1 ELSE (LOCATE('o' COLLATE utf8mb4_bin, SUBSTRING(name, 3)) + 1) END = 2`,
+		},
+		{
+			name:      "data_type field",
+			in:        `data_type == PIPELINE_RUN`,
+			want:      "type = 'tekton.dev/v1beta1.PipelineRun'",
+			wantMySQL: `type = 'tekton.dev/v1beta1.PipelineRun'`,
+		},
+		{
+			name:      "conditional expression with dyn branches",
+			in:        `(data_type == PIPELINE_RUN ? data.status.completionTime : data.status.startTime) > timestamp("2022-10-30T21:45:00Z")`,
+			want:      "CASE WHEN type = 'tekton.dev/v1beta1.PipelineRun' THEN (data->'status'->>'completionTime') ELSE (data->'status'->>'startTime') END::TIMESTAMP WITH TIME ZONE > '2022-10-30T21:45:00Z'::TIMESTAMP WITH TIME ZONE",
+			wantMySQL: `CAST(CASE WHEN type = 'tekton.dev/v1beta1.PipelineRun' THEN (JSON_UNQUOTE(JSON_EXTRACT(data, '$."status"."completionTime"'))) ELSE (JSON_UNQUOTE(JSON_EXTRACT(data, '$."status"."startTime"'))) END AS DATETIME) > CAST('2022-10-30T21:45:00Z' AS DATETIME)`,
+		},
+		{
+			name:      "conditional expression coerces the dyn branch to the type of the other one",
+			in:        `(data_type == PIPELINE_RUN ? data.status.completionTime : timestamp("2022-10-30T21:45:00Z")) > timestamp("2022-10-30T21:45:00Z")`,
+			want:      "CASE WHEN type = 'tekton.dev/v1beta1.PipelineRun' THEN (data->'status'->>'completionTime')::TIMESTAMP WITH TIME ZONE ELSE '2022-10-30T21:45:00Z'::TIMESTAMP WITH TIME ZONE END::TIMESTAMP WITH TIME ZONE > '2022-10-30T21:45:00Z'::TIMESTAMP WITH TIME ZONE",
+			wantMySQL: `CAST(CASE WHEN type = 'tekton.dev/v1beta1.PipelineRun' THEN CAST((JSON_UNQUOTE(JSON_EXTRACT(data, '$."status"."completionTime"'))) AS DATETIME) ELSE CAST('2022-10-30T21:45:00Z' AS DATETIME) END AS DATETIME) > CAST('2022-10-30T21:45:00Z' AS DATETIME)`,
+		},
+		{
+			name:      "timestamp arithmetic on a dyn field",
+			in:        `data.status.completionTime + duration("1h") > now()`,
+			want:      "(data->'status'->>'completionTime')::TIMESTAMP WITH TIME ZONE + '3600 SECONDS'::INTERVAL > NOW()",
+			wantMySQL: `CAST((JSON_UNQUOTE(JSON_EXTRACT(data, '$."status"."completionTime"'))) AS DATETIME) + INTERVAL 3600 SECOND > UTC_TIMESTAMP(6)`,
+		},
+		{
+			name:      "exists macro",
+			in:        `data.status.conditions.exists(c, c.type == "Succeeded" && c.status == "False")`,
+			want:      "EXISTS (SELECT 1 FROM jsonb_array_elements((data->'status'->'conditions')) AS element1 WHERE (element1->>'type') = 'Succeeded' AND (element1->>'status') = 'False')",
+			wantMySQL: `EXISTS (SELECT 1 FROM JSON_TABLE((JSON_EXTRACT(data, '$."status"."conditions"')), '$[*]' COLUMNS (element1 JSON PATH '$')) AS element1 WHERE (JSON_UNQUOTE(JSON_EXTRACT(element1, '$."type"'))) = 'Succeeded' AND (JSON_UNQUOTE(JSON_EXTRACT(element1, '$."status"'))) = 'False')`,
+		},
+		{
+			name:      "all macro",
+			in:        `data.status.conditions.all(c, c.status == "True")`,
+			want:      "NOT EXISTS (SELECT 1 FROM jsonb_array_elements((data->'status'->'conditions')) AS element1 WHERE ((element1->>'status') = 'True') IS NOT TRUE)",
+			wantMySQL: `NOT EXISTS (SELECT 1 FROM JSON_TABLE((JSON_EXTRACT(data, '$."status"."conditions"')), '$[*]' COLUMNS (element1 JSON PATH '$')) AS element1 WHERE ((JSON_UNQUOTE(JSON_EXTRACT(element1, '$."status"'))) = 'True') IS NOT TRUE)`,
+		},
+		{
+			name:      "exists_one macro",
+			in:        `data.spec.params.exists_one(p, p.name == "foo")`,
+			want:      "(SELECT count(*) FROM jsonb_array_elements((data->'spec'->'params')) AS element1 WHERE (element1->>'name') = 'foo') = 1",
+			wantMySQL: `(SELECT count(*) FROM JSON_TABLE((JSON_EXTRACT(data, '$."spec"."params"')), '$[*]' COLUMNS (element1 JSON PATH '$')) AS element1 WHERE (JSON_UNQUOTE(JSON_EXTRACT(element1, '$."name"'))) = 'foo') = 1`,
+		},
+		{
+			name:      "iteration variable bound to scalar elements",
+			in:        `data.spec.workspaces.exists(w, w == "source")`,
+			want:      "EXISTS (SELECT 1 FROM jsonb_array_elements((data->'spec'->'workspaces')) AS element1 WHERE (element1#>>'{}') = 'source')",
+			wantMySQL: `EXISTS (SELECT 1 FROM JSON_TABLE((JSON_EXTRACT(data, '$."spec"."workspaces"')), '$[*]' COLUMNS (element1 JSON PATH '$')) AS element1 WHERE (JSON_UNQUOTE(element1)) = 'source')`,
+		},
+		{
+			name:      "nested comprehensions",
+			in:        `data.status["taskRuns"].exists(t, t.conditions.exists(c, c.reason == "Failed"))`,
+			want:      "EXISTS (SELECT 1 FROM jsonb_array_elements((data->'status'->'taskRuns')) AS element1 WHERE EXISTS (SELECT 1 FROM jsonb_array_elements((element1->'conditions')) AS element2 WHERE (element2->>'reason') = 'Failed'))",
+			wantMySQL: `EXISTS (SELECT 1 FROM JSON_TABLE((JSON_EXTRACT(data, '$."status"."taskRuns"')), '$[*]' COLUMNS (element1 JSON PATH '$')) AS element1 WHERE EXISTS (SELECT 1 FROM JSON_TABLE((JSON_EXTRACT(element1, '$."conditions"')), '$[*]' COLUMNS (element2 JSON PATH '$')) AS element2 WHERE (JSON_UNQUOTE(JSON_EXTRACT(element2, '$."reason"'))) = 'Failed'))`,
+		},
+		{
+			name:      "iteration variables named after SQL keywords",
+			in:        `data.status.conditions.exists(order, data.spec.params.exists(end, end.name == order.reason))`,
+			want:      "EXISTS (SELECT 1 FROM jsonb_array_elements((data->'status'->'conditions')) AS element1 WHERE EXISTS (SELECT 1 FROM jsonb_array_elements((data->'spec'->'params')) AS element2 WHERE (element2->>'name') = (element1->>'reason')))",
+			wantMySQL: `EXISTS (SELECT 1 FROM JSON_TABLE((JSON_EXTRACT(data, '$."status"."conditions"')), '$[*]' COLUMNS (element1 JSON PATH '$')) AS element1 WHERE EXISTS (SELECT 1 FROM JSON_TABLE((JSON_EXTRACT(data, '$."spec"."params"')), '$[*]' COLUMNS (element2 JSON PATH '$')) AS element2 WHERE (JSON_UNQUOTE(JSON_EXTRACT(element2, '$."name"'))) = (JSON_UNQUOTE(JSON_EXTRACT(element1, '$."reason"')))))`,
+		},
+		{
+			name:      "shadowed iteration variables",
+			in:        `data.status.conditions.exists(c, data.status.conditions.exists(c, c.status == "True"))`,
+			want:      "EXISTS (SELECT 1 FROM jsonb_array_elements((data->'status'->'conditions')) AS element1 WHERE EXISTS (SELECT 1 FROM jsonb_array_elements((data->'status'->'conditions')) AS element2 WHERE (element2->>'status') = 'True'))",
+			wantMySQL: `EXISTS (SELECT 1 FROM JSON_TABLE((JSON_EXTRACT(data, '$."status"."conditions"')), '$[*]' COLUMNS (element1 JSON PATH '$')) AS element1 WHERE EXISTS (SELECT 1 FROM JSON_TABLE((JSON_EXTRACT(data, '$."status"."conditions"')), '$[*]' COLUMNS (element2 JSON PATH '$')) AS element2 WHERE (JSON_UNQUOTE(JSON_EXTRACT(element2, '$."status"'))) = 'True'))`,
+		},
+		{
+			name:      "has macro on a dyn field",
+			in:        `has(data.metadata.labels.app)`,
+			want:      `jsonb_path_exists(data, '$."metadata"."labels"."app"')`,
+			wantMySQL: `JSON_CONTAINS_PATH(data, 'one', '$."metadata"."labels"."app"')`,
+		},
+		{
+			name:      "negated has macro",
+			in:        `!has(data.status.completionTime)`,
+			want:      `NOT jsonb_path_exists(data, '$."status"."completionTime"')`,
+			wantMySQL: `NOT JSON_CONTAINS_PATH(data, 'one', '$."status"."completionTime"')`,
+		},
+		{
+			name:      "comparison with null",
+			in:        `data.status.completionTime == null`,
+			want:      `data->'status'->'completionTime' = 'null'::jsonb`,
+			wantMySQL: `JSON_TYPE(JSON_EXTRACT(data, '$."status"."completionTime"')) = 'NULL'`,
 		},
 		{
-			name: "type coercion with a dyn expression in the left hand side",
-			in:   `data.status.completionTime > timestamp("2022/10/30T21:45:00.000Z")`,
-			want: "(data->'status'->>'completionTime')::TIMESTAMP WITH TIME ZONE > '2022/10/30T21:45:00.000Z'::TIMESTAMP WITH TIME ZONE",
+			name:      "inequality with null",
+			in:        `null != data.spec.params[0]`,
+			want:      `data->'spec'->'params'->0 <> 'null'::jsonb`,
+			wantMySQL: `JSON_TYPE(JSON_EXTRACT(data, '$."spec"."params"[0]')) <> 'NULL'`,
 		},
 		{
-			name: "type coercion with a dyn expression in the right hand side",
-			in:   `timestamp("2022/10/30T21:45:00.000Z") < data.status.completionTime`,
-			want: "'2022/10/30T21:45:00.000Z'::TIMESTAMP WITH TIME ZONE < (data->'status'->>'completionTime')::TIMESTAMP WITH TIME ZONE",
+			name:      "comparison of an iteration variable with null",
+			in:        `data.status.conditions.exists(c, c.reason == null)`,
+			want:      `EXISTS (SELECT 1 FROM jsonb_array_elements((data->'status'->'conditions')) AS element1 WHERE element1->'reason' = 'null'::jsonb)`,
+			wantMySQL: `EXISTS (SELECT 1 FROM JSON_TABLE((JSON_EXTRACT(data, '$."status"."conditions"')), '$[*]' COLUMNS (element1 JSON PATH '$')) AS element1 WHERE JSON_TYPE(JSON_EXTRACT(element1, '$."reason"')) = 'NULL')`,
 		},
 		{
-			name: "in operator",
-			in:   `data.metadata.namespace in ["foo", "bar"]`,
-			want: "(data->'metadata'->>'namespace') IN ('foo', 'bar')",
+			name:      "has macro on an iteration variable",
+			in:        `data.status.conditions.exists(c, has(c.reason))`,
+			want:      `EXISTS (SELECT 1 FROM jsonb_array_elements((data->'status'->'conditions')) AS element1 WHERE jsonb_path_exists(element1, '$."reason"'))`,
+			wantMySQL: `EXISTS (SELECT 1 FROM JSON_TABLE((JSON_EXTRACT(data, '$."status"."conditions"')), '$[*]' COLUMNS (element1 JSON PATH '$')) AS element1 WHERE JSON_CONTAINS_PATH(element1, 'one', '$."reason"'))`,
 		},
 		{
-			name: "index operator",
-			in:   `data.metadata.labels["foo"] == "bar"`,
-			want: "(data->'metadata'->'labels'->>'foo') = 'bar'",
+			name:      "size function on a dyn field",
+			in:        `size(data.spec.params) > 3`,
+			want:      "CASE jsonb_typeof((data->'spec'->'params')) WHEN 'array' THEN jsonb_array_length((data->'spec'->'params')) WHEN 'object' THEN (SELECT count(*) FROM jsonb_object_keys((data->'spec'->'params'))) WHEN 'string' THEN char_length((data->'spec'->'params')#>>'{}') END > 3",
+			wantMySQL: `CASE JSON_TYPE((JSON_EXTRACT(data, '$."spec"."params"'))) WHEN 'STRING' THEN CHAR_LENGTH(JSON_UNQUOTE((JSON_EXTRACT(data, '$."spec"."params"')))) ELSE JSON_LENGTH((JSON_EXTRACT(data, '$."spec"."params"'))) END > 3`,
 		},
 		{
-			name: "contains string function",
-			in:   `data.metadata.name.contains("foo")`,
-			want: "POSITION('foo' IN (data->'metadata'->>'name')) <> 0",
+			name:      "size method on a dyn field",
+			in:        `data.metadata.name.size() < 10`,
+			want:      "CASE jsonb_typeof((data->'metadata'->'name')) WHEN 'array' THEN jsonb_array_length((data->'metadata'->'name')) WHEN 'object' THEN (SELECT count(*) FROM jsonb_object_keys((data->'metadata'->'name'))) WHEN 'string' THEN char_length((data->'metadata'->'name')#>>'{}') END < 10",
+			wantMySQL: `CASE JSON_TYPE((JSON_EXTRACT(data, '$."metadata"."name"'))) WHEN 'STRING' THEN CHAR_LENGTH(JSON_UNQUOTE((JSON_EXTRACT(data, '$."metadata"."name"')))) ELSE JSON_LENGTH((JSON_EXTRACT(data, '$."metadata"."name"'))) END < 10`,
 		},
 		{
-			name: "endsWith string function",
-			in:   `data.metadata.name.endsWith("bar")`,
-			want: "(data->'metadata'->>'name') LIKE '%' || 'bar'",
+			name:      "has macro on a JSON array element",
+			in:        `has(data.spec.params[1].value)`,
+			want:      `jsonb_path_exists(data, '$."spec"."params"[1]."value"')`,
+			wantMySQL: `JSON_CONTAINS_PATH(data, 'one', '$."spec"."params"[1]."value"')`,
 		},
 		{
-			name: "getDate function",
-			in:   `data.status.completionTime.getDate() == 2`,
-			want: "EXTRACT(DAY FROM (data->'status'->>'completionTime')::TIMESTAMP WITH TIME ZONE) = 2",
+			name:      "size function on a string field",
+			in:        `size(name) < 10`,
+			want:      "char_length(name) < 10",
+			wantMySQL: `CHAR_LENGTH(name) < 10`,
 		},
 		{
-			name: "getDayOfMonth function",
-			in:   `data.status.completionTime.getDayOfMonth() == 2`,
-			want: "(EXTRACT(DAY FROM (data->'status'->>'completionTime')::TIMESTAMP WITH TIME ZONE) - 1) = 2",
+			name:      "int conversion function",
+			in:        `int(data.metadata.annotations["attempt"]) >= 2`,
+			want:      "CASE WHEN (data->'metadata'->'annotations'->>'attempt') ~ '^[+-]?[0-9]+$' THEN (data->'metadata'->'annotations'->>'attempt')::BIGINT ELSE NULL END >= 2",
+			wantMySQL: `CASE WHEN REGEXP_LIKE((JSON_UNQUOTE(JSON_EXTRACT(data, '$."metadata"."annotations"."attempt"'))), '^[+-]?[0-9]+$') THEN CAST((JSON_UNQUOTE(JSON_EXTRACT(data, '$."metadata"."annotations"."attempt"'))) AS SIGNED) ELSE NULL END >= 2`,
 		},
 		{
-			name: "getDayOfWeek function",
-			in:   `data.status.completionTime.getDayOfWeek() > 0`,
-			want: "EXTRACT(DOW FROM (data->'status'->>'completionTime')::TIMESTAMP WITH TIME ZONE) > 0",
+			name:      "int conversion function on a double",
+			in:        `int(data.spec.ratio * 10.0) == 5`,
+			want:      "trunc(((data->'spec'->>'ratio')::DOUBLE PRECISION * 10.0))::BIGINT = 5",
+			wantMySQL: `CAST(TRUNCATE((CAST((JSON_UNQUOTE(JSON_EXTRACT(data, '$."spec"."ratio"'))) AS DOUBLE) * 10.0), 0) AS SIGNED) = 5`,
 		},
 		{
-			name: "getDayOfYear function",
-			in:   `data.status.completionTime.getDayOfYear() > 15`,
-			want: "(EXTRACT(DOY FROM (data->'status'->>'completionTime')::TIMESTAMP WITH TIME ZONE) - 1) > 15",
+			name:      "double literals",
+			in:        `double(data.spec.retries) / 2.0 > 6.0 / 3.0`,
+			want:      "CASE WHEN (data->'spec'->>'retries') ~ '^[+-]?([0-9]+([.][0-9]*)?|[.][0-9]+)([eE][+-]?[0-9]+)?$' THEN (data->'spec'->>'retries')::DOUBLE PRECISION ELSE NULL END / 2.0 > 2.0",
+			wantMySQL: `CASE WHEN REGEXP_LIKE((JSON_UNQUOTE(JSON_EXTRACT(data, '$."spec"."retries"'))), '^[+-]?([0-9]+([.][0-9]*)?|[.][0-9]+)([eE][+-]?[0-9]+)?$') THEN CAST((JSON_UNQUOTE(JSON_EXTRACT(data, '$."spec"."retries"'))) AS DOUBLE) ELSE NULL END / 2.0 > 2.0`,
 		},
 		{
-			name: "getFullYear function",
-			in:   `data.status.completionTime.getFullYear() >= 2022`,
-			want: "EXTRACT(YEAR FROM (data->'status'->>'completionTime')::TIMESTAMP WITH TIME ZONE) >= 2022",
+			name:      "double conversion function",
+			in:        `double(data.spec.ratio) > 0.5`,
+			want:      "CASE WHEN (data->'spec'->>'ratio') ~ '^[+-]?([0-9]+([.][0-9]*)?|[.][0-9]+)([eE][+-]?[0-9]+)?$' THEN (data->'spec'->>'ratio')::DOUBLE PRECISION ELSE NULL END > 0.5",
+			wantMySQL: `CASE WHEN REGEXP_LIKE((JSON_UNQUOTE(JSON_EXTRACT(data, '$."spec"."ratio"'))), '^[+-]?([0-9]+([.][0-9]*)?|[.][0-9]+)([eE][+-]?[0-9]+)?$') THEN CAST((JSON_UNQUOTE(JSON_EXTRACT(data, '$."spec"."ratio"'))) AS DOUBLE) ELSE NULL END > 0.5`,
 		},
 		{
-			name: "matches function",
-			in:   `data.metadata.name.matches("^foo.*$")`,
-			want: "(data->'metadata'->>'name') ~ '^foo.*$'",
+			name:      "string conversion function",
+			in:        `string(size(name)) == "3"`,
+			want:      "char_length(name)::TEXT = '3'",
+			wantMySQL: `CAST(CHAR_LENGTH(name) AS CHAR) = '3'`,
 		},
 		{
-			name: "startsWith string function",
-			in:   `data.metadata.name.startsWith("bar")`,
-			want: "(data->'metadata'->>'name') LIKE 'bar' || '%'",
+			name:      "bool conversion function",
+			in:        `bool(data.metadata.annotations["skip"])`,
+			want:      "CASE WHEN (data->'metadata'->'annotations'->>'skip') IN ('1', 't', 'true', 'TRUE', 'True') THEN TRUE ELSE CASE WHEN (data->'metadata'->'annotations'->>'skip') IN ('0', 'f', 'false', 'FALSE', 'False') THEN FALSE ELSE NULL END END",
+			wantMySQL: `CASE WHEN (JSON_UNQUOTE(JSON_EXTRACT(data, '$."metadata"."annotations"."skip"'))) IN ('1', 't', 'true', 'TRUE', 'True') THEN TRUE ELSE CASE WHEN (JSON_UNQUOTE(JSON_EXTRACT(data, '$."metadata"."annotations"."skip"'))) IN ('0', 'f', 'false', 'FALSE', 'False') THEN FALSE ELSE NULL END END`,
 		},
 		{
-			name: "data_type field",
-			in:   `data_type == PIPELINE_RUN`,
-			want: "type = 'tekton.dev/v1beta1.PipelineRun'",
+			name:      "duration conversion function",
+			in:        `duration(data.spec.timeout) > duration("1h")`,
+			want:      "CASE WHEN (data->'spec'->>'timeout') ~ '^([0-9]+([.][0-9]*)?(ms|h|m|s))+$' THEN (data->'spec'->>'timeout')::INTERVAL ELSE NULL END > '3600 SECONDS'::INTERVAL",
+			wantMySQL: `CASE WHEN REGEXP_LIKE((JSON_UNQUOTE(JSON_EXTRACT(data, '$."spec"."timeout"'))), '^([0-9]+([.][0-9]*)?(ms|h|m|s))+$') THEN (COALESCE(REGEXP_REPLACE(REGEXP_SUBSTR((JSON_UNQUOTE(JSON_EXTRACT(data, '$."spec"."timeout"'))), '[0-9.]+h'), '[a-z].*', ''), 0) * 3600 + COALESCE(REGEXP_REPLACE(REGEXP_SUBSTR((JSON_UNQUOTE(JSON_EXTRACT(data, '$."spec"."timeout"'))), '[0-9.]+m([^s]|$)'), '[a-z].*', ''), 0) * 60 + COALESCE(REGEXP_REPLACE(REGEXP_SUBSTR((JSON_UNQUOTE(JSON_EXTRACT(data, '$."spec"."timeout"'))), '[0-9.]+s'), '[a-z].*', ''), 0) * 1 + COALESCE(REGEXP_REPLACE(REGEXP_SUBSTR((JSON_UNQUOTE(JSON_EXTRACT(data, '$."spec"."timeout"'))), '[0-9.]+ms'), '[a-z].*', ''), 0) * 0.001) ELSE NULL END > 3600`,
+		},
+		{
+			name:      "string literals are escaped",
+			in:        `name == "x' OR 1=1 --"`,
+			want:      "name = 'x'' OR 1=1 --'",
+			wantMySQL: `name = 'x'' OR 1=1 --'`,
+		},
+		{
+			name:      "JSON keys are escaped",
+			in:        `data.metadata.labels["it's"] == "foo"`,
+			want:      `data @> '{"metadata":{"labels":{"it''s":"foo"}}}'::jsonb`,
+			wantMySQL: `(JSON_UNQUOTE(JSON_EXTRACT(data, '$."metadata"."labels"."it''s"'))) = 'foo'`,
 		},
 	}
 
@@ -110,87 +567,811 @@ func TestConvertRecordExpressions(t *testing.T) {
 			if diff := cmp.Diff(test.want, got); diff != "" {
 				t.Errorf("Mismatch (-want +got):\n%s", diff)
 			}
+
+			gotMySQL, err := Convert(env, test.in, WithDialect(MySQLDialect{}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(test.wantMySQL, gotMySQL); diff != "" {
+				t.Errorf("Mismatch in the MySQL dialect (-want +got):\n%s", diff)
+			}
 		})
 	}
 }
 
 func TestConvertResultExpressions(t *testing.T) {
+	tests := []struct {
+		name      string
+		in        string
+		want      string
+		wantMySQL string
+	}{{
+		name:      "Result.Annotations field",
+		in:        `annotations["repo"] == "tektoncd/results"`,
+		want:      `annotations @> '{"repo":"tektoncd/results"}'::jsonb`,
+		wantMySQL: `JSON_UNQUOTE(JSON_EXTRACT(annotations, '$."repo"')) = 'tektoncd/results'`,
+	},
+		{
+			name:      "difference of timestamps",
+			in:        `summary.end_time - summary.start_time > duration("1h")`,
+			want:      "recordsummary_end_time - recordsummary_start_time > '3600 SECONDS'::INTERVAL",
+			wantMySQL: "TIMESTAMPDIFF(MICROSECOND, recordsummary_start_time, recordsummary_end_time) / 1000000 > 3600",
+		},
+		{
+			name:      "Result.Annotations field",
+			in:        `"tektoncd/results" == annotations["repo"]`,
+			want:      `annotations @> '{"repo":"tektoncd/results"}'::jsonb`,
+			wantMySQL: `'tektoncd/results' = JSON_UNQUOTE(JSON_EXTRACT(annotations, '$."repo"'))`,
+		},
+		{
+			name:      "other operators involving the Result.Annotations field",
+			in:        `annotations["repo"].startsWith("tektoncd")`,
+			want:      "(annotations->>'repo') LIKE 'tektoncd' || '%' ESCAPE '!'",
+			wantMySQL: `(JSON_UNQUOTE(JSON_EXTRACT(annotations, '$."repo"'))) LIKE CONCAT('tektoncd', '%') ESCAPE '!'`,
+		},
+		{
+			name:      "Result.Summary.Record field",
+			in:        `summary.record == "foo/results/bar/records/baz"`,
+			want:      "recordsummary_record = 'foo/results/bar/records/baz'",
+			wantMySQL: `recordsummary_record = 'foo/results/bar/records/baz'`,
+		},
+		{
+			name:      "Result.Summary.StartTime field",
+			in:        `summary.start_time > timestamp("2022/10/30T21:45:00.000Z")`,
+			want:      "recordsummary_start_time > '2022/10/30T21:45:00.000Z'::TIMESTAMP WITH TIME ZONE",
+			wantMySQL: `recordsummary_start_time > CAST('2022/10/30T21:45:00.000Z' AS DATETIME)`,
+		},
+		{
+			name:      "comparison with the PIPELINE_RUN const value",
+			in:        `summary.type == PIPELINE_RUN`,
+			want:      "recordsummary_type = 'tekton.dev/v1beta1.PipelineRun'",
+			wantMySQL: `recordsummary_type = 'tekton.dev/v1beta1.PipelineRun'`,
+		},
+		{
+			name:      "comparison with the TASK_RUN const value",
+			in:        `summary.type == TASK_RUN`,
+			want:      "recordsummary_type = 'tekton.dev/v1beta1.TaskRun'",
+			wantMySQL: `recordsummary_type = 'tekton.dev/v1beta1.TaskRun'`,
+		},
+		{
+			name:      "string conversion function on an enum field",
+			in:        `string(summary.status) == "1"`,
+			want:      "recordsummary_status::TEXT = '1'",
+			wantMySQL: `CAST(recordsummary_status AS CHAR) = '1'`,
+		},
+		{
+			name:      "RecordSummary_Status constants",
+			in:        `summary.status == CANCELLED || summary.status == TIMEOUT`,
+			want:      "recordsummary_status = 4 OR recordsummary_status = 3",
+			wantMySQL: `recordsummary_status = 4 OR recordsummary_status = 3`,
+		},
+		{
+			name:      "disjunction grouped within a conjunction",
+			in:        `(summary.status == SUCCESS || summary.status == FAILURE) && summary.type == PIPELINE_RUN`,
+			want:      "(recordsummary_status = 1 OR recordsummary_status = 2) AND recordsummary_type = 'tekton.dev/v1beta1.PipelineRun'",
+			wantMySQL: `(recordsummary_status = 1 OR recordsummary_status = 2) AND recordsummary_type = 'tekton.dev/v1beta1.PipelineRun'`,
+		},
+		{
+			name:      "negated disjunction",
+			in:        `!(summary.status == SUCCESS || summary.status == FAILURE)`,
+			want:      "NOT (recordsummary_status = 1 OR recordsummary_status = 2)",
+			wantMySQL: `NOT (recordsummary_status = 1 OR recordsummary_status = 2)`,
+		},
+		{
+			name:      "comparison of comparisons",
+			in:        `(summary.status == SUCCESS) == (summary.type == PIPELINE_RUN)`,
+			want:      "(recordsummary_status = 1) = (recordsummary_type = 'tekton.dev/v1beta1.PipelineRun')",
+			wantMySQL: `(recordsummary_status = 1) = (recordsummary_type = 'tekton.dev/v1beta1.PipelineRun')`,
+		},
+		{
+			name:      "relative time filter",
+			in:        `summary.start_time > now() - duration("24h")`,
+			want:      "recordsummary_start_time > NOW() - '86400 SECONDS'::INTERVAL",
+			wantMySQL: `recordsummary_start_time > UTC_TIMESTAMP(6) - INTERVAL 86400 SECOND`,
+		},
+		{
+			name:      "duration added to a timestamp",
+			in:        `duration("1.5s") + summary.start_time < summary.end_time`,
+			want:      "recordsummary_start_time + '1.5 SECONDS'::INTERVAL < recordsummary_end_time",
+			wantMySQL: `recordsummary_start_time + INTERVAL 1500000 MICROSECOND < recordsummary_end_time`,
+		},
+		{
+			name:      "constant timestamp arithmetic",
+			in:        `summary.end_time > timestamp("2023-01-01T00:00:00Z") + duration("72h")`,
+			want:      "recordsummary_end_time > '2023-01-04T00:00:00Z'::TIMESTAMP WITH TIME ZONE",
+			wantMySQL: `recordsummary_end_time > CAST('2023-01-04T00:00:00Z' AS DATETIME)`,
+		},
+		{
+			name:      "Result.Summary.Annotations",
+			in:        `summary.annotations["branch"] == "main"`,
+			want:      `recordsummary_annotations @> '{"branch":"main"}'::jsonb`,
+			wantMySQL: `JSON_UNQUOTE(JSON_EXTRACT(recordsummary_annotations, '$."branch"')) = 'main'`,
+		},
+		{
+			name:      "Result.Summary.Annotations",
+			in:        `"main" == summary.annotations["branch"]`,
+			want:      `recordsummary_annotations @> '{"branch":"main"}'::jsonb`,
+			wantMySQL: `'main' = JSON_UNQUOTE(JSON_EXTRACT(recordsummary_annotations, '$."branch"'))`,
+		},
+		{
+			name:      "more complex expression",
+			in:        `summary.annotations["actor"] == "john-doe" && summary.annotations["branch"] == "feat/amazing" && summary.status == SUCCESS`,
+			want:      `recordsummary_annotations @> '{"actor":"john-doe","branch":"feat/amazing"}'::jsonb AND recordsummary_status = 1`,
+			wantMySQL: `JSON_UNQUOTE(JSON_EXTRACT(recordsummary_annotations, '$."actor"')) = 'john-doe' AND JSON_UNQUOTE(JSON_EXTRACT(recordsummary_annotations, '$."branch"')) = 'feat/amazing' AND recordsummary_status = 1`,
+		},
+		{
+			name:      "conditional expression",
+			in:        `(summary.type == PIPELINE_RUN ? summary.end_time : summary.start_time) > timestamp("2022-10-30T21:45:00Z")`,
+			want:      "CASE WHEN recordsummary_type = 'tekton.dev/v1beta1.PipelineRun' THEN recordsummary_end_time ELSE recordsummary_start_time END > '2022-10-30T21:45:00Z'::TIMESTAMP WITH TIME ZONE",
+			wantMySQL: `CASE WHEN recordsummary_type = 'tekton.dev/v1beta1.PipelineRun' THEN recordsummary_end_time ELSE recordsummary_start_time END > CAST('2022-10-30T21:45:00Z' AS DATETIME)`,
+		},
+		{
+			name:      "comparison with null",
+			in:        `summary.end_time == null`,
+			want:      "recordsummary_end_time IS NULL",
+			wantMySQL: `recordsummary_end_time IS NULL`,
+		},
+		{
+			name:      "inequality with null",
+			in:        `summary.end_time != null`,
+			want:      "recordsummary_end_time IS NOT NULL",
+			wantMySQL: `recordsummary_end_time IS NOT NULL`,
+		},
+		{
+			name:      "has macro on a RecordSummary field",
+			in:        `has(summary.end_time)`,
+			want:      "recordsummary_end_time IS NOT NULL",
+			wantMySQL: `recordsummary_end_time IS NOT NULL`,
+		},
+		{
+			name:      "has macro on the Result.Annotations field",
+			in:        `has(annotations.repo)`,
+			want:      `jsonb_path_exists(annotations, '$."repo"')`,
+			wantMySQL: `JSON_CONTAINS_PATH(annotations, 'one', '$."repo"')`,
+		},
+		{
+			name:      "has macro on the Result.Summary.Annotations field",
+			in:        `has(summary.annotations.branch)`,
+			want:      `jsonb_path_exists(recordsummary_annotations, '$."branch"')`,
+			wantMySQL: `JSON_CONTAINS_PATH(recordsummary_annotations, 'one', '$."branch"')`,
+		},
+		{
+			name:      "size function on a map field",
+			in:        `size(annotations) == 0`,
+			want:      "(SELECT count(*) FROM jsonb_object_keys(annotations)) = 0",
+			wantMySQL: `JSON_LENGTH(annotations) = 0`,
+		},
+		{
+			name:      "size method on the Result.Summary.Annotations field",
+			in:        `summary.annotations.size() > 1`,
+			want:      "(SELECT count(*) FROM jsonb_object_keys(recordsummary_annotations)) > 1",
+			wantMySQL: `JSON_LENGTH(recordsummary_annotations) > 1`,
+		},
+		{
+			name:      "JSON documents are escaped",
+			in:        `annotations["repo"] == "it's \"quoted\""`,
+			want:      `annotations @> '{"repo":"it''s \"quoted\""}'::jsonb`,
+			wantMySQL: `JSON_UNQUOTE(JSON_EXTRACT(annotations, '$."repo"')) = 'it''s "quoted"'`,
+		},
+	}
+
+	env, err := cel.NewResultsEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Convert(env, test.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("Mismatch (-want +got):\n%s", diff)
+			}
+
+			gotMySQL, err := Convert(env, test.in, WithDialect(MySQLDialect{}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(test.wantMySQL, gotMySQL); diff != "" {
+				t.Errorf("Mismatch in the MySQL dialect (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestConvertErrors(t *testing.T) {
 	tests := []struct {
 		name string
 		in   string
+		opts []Option
 		want string
 	}{{
-		name: "Result.Annotations field",
-		in:   `annotations["repo"] == "tektoncd/results"`,
-		want: `annotations @> '{"repo":"tektoncd/results"}'::jsonb`,
+		name: "unknown time zone",
+		in:   `data.status.completionTime.getHours("Mars/Olympus") == 0`,
+		want: "unsupported CEL time zone statement at line 1, column 36: unknown time zone Mars/Olympus",
 	},
 		{
-			name: "Result.Annotations field",
-			in:   `"tektoncd/results" == annotations["repo"]`,
-			want: `annotations @> '{"repo":"tektoncd/results"}'::jsonb`,
+			name: "non-constant time zone",
+			in:   `data.status.completionTime.getHours(name) == 0`,
+			want: "unsupported CEL non-constant time zone statement at line 1, column 36",
+		},
+		{
+			name: "split function in a dialect without arrays",
+			in:   `"foo" in name.split(",")`,
+			opts: []Option{WithDialect(MySQLDialect{})},
+			want: "unsupported CEL `split` function statement at line 1, column 19: the SQL dialect doesn't support arrays",
+		},
+		{
+			name: "lowerAscii function in a dialect without ASCII case mapping",
+			in:   `name.lowerAscii() == "foo"`,
+			opts: []Option{WithDialect(MySQLDialect{})},
+			want: "unsupported CEL `lowerAscii` function statement at line 1, column 15: the SQL dialect can't change the case of ASCII letters only",
+		},
+		{
+			name: "conversion function with an unsupported argument",
+			in:   `int(now()) > 0`,
+			want: "unsupported CEL `int` function with a timestamp argument statement at line 1, column 3",
 		},
 		{
-			name: "other operators involving the Result.Annotations field",
-			in:   `annotations["repo"].startsWith("tektoncd")`,
-			want: "annotations->>'repo' LIKE 'tektoncd' || '%'",
+			name: "infinite constant",
+			in:   `data.spec.ratio == 1.0 / 0.0`,
+			want: "unsupported CEL non-finite double statement at line 1, column 23: it evaluates to +Inf",
 		},
 		{
-			name: "Result.Summary.Record field",
-			in:   `summary.record == "foo/results/bar/records/baz"`,
-			want: "recordsummary_record = 'foo/results/bar/records/baz'",
+			name: "NaN constant",
+			in:   `data.spec.ratio < 0.0 / 0.0`,
+			want: "unsupported CEL non-finite double statement at line 1, column 22: it evaluates to NaN",
 		},
 		{
-			name: "Result.Summary.StartTime field",
-			in:   `summary.start_time > timestamp("2022/10/30T21:45:00.000Z")`,
-			want: "recordsummary_start_time > '2022/10/30T21:45:00.000Z'::TIMESTAMP WITH TIME ZONE",
+			name: "non-constant index in a JSON path",
+			in:   `data.spec.params[size(name)].value == "x"`,
+			want: "unsupported CEL non-constant index statement at line 1, column 21",
 		},
 		{
-			name: "comparison with the PIPELINE_RUN const value",
-			in:   `summary.type == PIPELINE_RUN`,
-			want: "recordsummary_type = 'tekton.dev/v1beta1.PipelineRun'",
+			name: "negative index in a JSON path",
+			in:   `data.spec.params[-1].value == "x"`,
+			want: "unsupported CEL negative index statement at line 1, column 17",
 		},
 		{
-			name: "comparison with the TASK_RUN const value",
-			in:   `summary.type == TASK_RUN`,
-			want: "recordsummary_type = 'tekton.dev/v1beta1.TaskRun'",
+			name: "JSON path through a conditional expression",
+			in:   `(name == "foo" ? data.spec : data.status).value == "x"`,
+			want: "unsupported CEL JSON path statement at line 1, column 15",
 		},
 		{
-			name: "RecordSummary_Status constants",
-			in:   `summary.status == CANCELLED || summary.status == TIMEOUT`,
-			want: "recordsummary_status = 4  OR recordsummary_status = 3",
+			name: "non-constant regular expression",
+			in:   `name.matches(data_type)`,
+			want: "unsupported CEL non-constant pattern statement at line 1, column 13",
 		},
 		{
-			name: "Result.Summary.Annotations",
-			in:   `summary.annotations["branch"] == "main"`,
-			want: `recordsummary_annotations @> '{"branch":"main"}'::jsonb`,
+			name: "regular expression with word boundaries",
+			in:   `name.matches("\\bfoo")`,
+			want: "unsupported CEL regular expression statement at line 1, column 13: word boundaries aren't supported",
 		},
 		{
-			name: "Result.Summary.Annotations",
-			in:   `"main" == summary.annotations["branch"]`,
-			want: `recordsummary_annotations @> '{"branch":"main"}'::jsonb`,
+			name: "regular expression with multi-line anchors",
+			in:   `name.matches("(?m)^foo$")`,
+			want: "unsupported CEL regular expression statement at line 1, column 13: multi-line anchors aren't supported",
 		},
 		{
-			name: "more complex expression",
-			in:   `summary.annotations["actor"] == "john-doe" && summary.annotations["branch"] == "feat/amazing" && summary.status == SUCCESS`,
-			want: `recordsummary_annotations @> '{"actor":"john-doe"}'::jsonb AND recordsummary_annotations @> '{"branch":"feat/amazing"}'::jsonb  AND recordsummary_status = 1`,
+			name: "expensive regular expression",
+			in:   `name.matches("a{1000}")`,
+			want: "unsupported CEL regular expression statement at line 1, column 13: the regular expression is too expensive",
+		},
+		{
+			name: "replace function with a limit",
+			in:   `name.replace("-", "_", 1) == "foo_bar"`,
+			want: "unsupported CEL `replace` function with a limit statement at line 1, column 12",
 		},
 	}
 
-	env, err := cel.NewResultsEnv()
+	env, err := cel.NewRecordsEnv()
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			got, err := Convert(env, test.in)
+			_, err := Convert(env, test.in, test.opts...)
+			if !errors.Is(err, ErrUnsupportedExpression) {
+				t.Fatalf("Want ErrUnsupportedExpression, but got %v", err)
+			}
+
+			if diff := cmp.Diff(test.want, err.Error()); diff != "" {
+				t.Errorf("Mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestConvertExpensiveClosedExpressions(t *testing.T) {
+	env, err := cel.NewRecordsEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Evaluating the nested comprehensions takes 10^7 iterations, so they're
+	// left to the interpreter, which doesn't support iterating over list
+	// literals, instead of being folded into true.
+	in := "a + b + c + d + e + f + g >= 0"
+	for _, variable := range []string{"g", "f", "e", "d", "c", "b", "a"} {
+		in = fmt.Sprintf("[0, 1, 2, 3, 4, 5, 6, 7, 8, 9].all(%s, %s)", variable, in)
+	}
+
+	_, err = Convert(env, in)
+	if !errors.Is(err, ErrUnsupportedExpression) {
+		t.Fatalf("Want ErrUnsupportedExpression, but got %v", err)
+	}
+}
+
+func TestConvertWithVars(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       string
+		opts     []Option
+		want     string
+		wantVars []any
+		newEnv   func() (*celgo.Env, error)
+	}{{
+		name:     "string literal",
+		in:       `name == "x' OR 1=1 --"`,
+		newEnv:   cel.NewRecordsEnv,
+		want:     "name = ?",
+		wantVars: []any{"x' OR 1=1 --"},
+	},
+		{
+			name:     "JSON keys",
+			in:       `data.metadata.labels["foo"] == "bar"`,
+			opts:     []Option{WithJSONContainment(false)},
+			newEnv:   cel.NewRecordsEnv,
+			want:     "(data->?->?->>?) = ?",
+			wantVars: []any{"metadata", "labels", "foo", "bar"},
+		},
+		{
+			name:     "JSON array indices",
+			in:       `data.spec.params[0].value == "bar"`,
+			newEnv:   cel.NewRecordsEnv,
+			want:     "(data->?->?->0->>?) = ?",
+			wantVars: []any{"spec", "params", "value", "bar"},
+		},
+		{
+			name:     "nested JSON documents",
+			in:       `data.spec.timeouts.retries == 3 && data.spec.enabled == true`,
+			newEnv:   cel.NewRecordsEnv,
+			want:     "data @> ?::jsonb",
+			wantVars: []any{`{"spec":{"enabled":true,"timeouts":{"retries":3}}}`},
+		},
+		{
+			name:     "in operator",
+			in:       `data.metadata.namespace in ["foo", "bar"]`,
+			newEnv:   cel.NewRecordsEnv,
+			want:     "(data->?->>?) IN (?, ?)",
+			wantVars: []any{"metadata", "namespace", "foo", "bar"},
+		},
+		{
+			name:     "JSON documents",
+			in:       `annotations["repo"] == "tektoncd/results"`,
+			newEnv:   cel.NewResultsEnv,
+			want:     "annotations @> ?::jsonb",
+			wantVars: []any{`{"repo":"tektoncd/results"}`},
+		},
+		{
+			name:     "index on annotations",
+			in:       `annotations["repo"].startsWith("tektoncd")`,
+			newEnv:   cel.NewResultsEnv,
+			want:     "(annotations->>?) LIKE ? || '%' ESCAPE '!'",
+			wantVars: []any{"repo", "tektoncd"},
+		},
+		{
+			name:     "dollar numbered placeholders",
+			in:       `summary.status == CANCELLED || summary.record == "foo"`,
+			opts:     []Option{WithPlaceholderStyle(DollarNumbered)},
+			newEnv:   cel.NewResultsEnv,
+			want:     "recordsummary_status = $1 OR recordsummary_record = $2",
+			wantVars: []any{int64(4), "foo"},
+		},
+		{
+			name:     "JSON paths in the MySQL dialect",
+			in:       `data.metadata.labels["foo"] == "bar"`,
+			opts:     []Option{WithDialect(MySQLDialect{}), WithJSONContainment(false)},
+			newEnv:   cel.NewRecordsEnv,
+			want:     "(JSON_UNQUOTE(JSON_EXTRACT(data, ?))) = ?",
+			wantVars: []any{`$."metadata"."labels"."foo"`, "bar"},
+		},
+		{
+			name:     "values repeated by the dialect",
+			in:       `size(data.spec.params) > 3`,
+			opts:     []Option{WithPlaceholderStyle(DollarNumbered)},
+			newEnv:   cel.NewRecordsEnv,
+			want:     "CASE jsonb_typeof((data->$1->$2)) WHEN 'array' THEN jsonb_array_length((data->$3->$4)) WHEN 'object' THEN (SELECT count(*) FROM jsonb_object_keys((data->$5->$6))) WHEN 'string' THEN char_length((data->$7->$8)#>>'{}') END > $9",
+			wantVars: []any{"spec", "params", "spec", "params", "spec", "params", "spec", "params", int64(3)},
+		},
+		{
+			name:     "fixed clock",
+			in:       `summary.start_time > now() - duration("24h")`,
+			opts:     []Option{WithNow(time.Date(2023, 1, 16, 10, 0, 0, 0, time.FixedZone("", 3600)))},
+			newEnv:   cel.NewResultsEnv,
+			want:     "recordsummary_start_time > ?::TIMESTAMP WITH TIME ZONE - ?::INTERVAL",
+			wantVars: []any{"2023-01-16T09:00:00Z", "86400 SECONDS"},
+		},
+		{
+			name:     "lowerAscii function",
+			in:       `data.metadata.name.lowerAscii() == "foo"`,
+			opts:     []Option{WithJSONContainment(false)},
+			newEnv:   cel.NewRecordsEnv,
+			want:     "translate((data->?->>?), 'ABCDEFGHIJKLMNOPQRSTUVWXYZ', 'abcdefghijklmnopqrstuvwxyz') = ?",
+			wantVars: []any{"metadata", "name", "foo"},
+		},
+		{
+			name:     "upperAscii function",
+			in:       `name.upperAscii() == "FOO"`,
+			newEnv:   cel.NewRecordsEnv,
+			want:     "translate(name, 'abcdefghijklmnopqrstuvwxyz', 'ABCDEFGHIJKLMNOPQRSTUVWXYZ') = ?",
+			wantVars: []any{"FOO"},
+		},
+		{
+			name:     "in operator with the split function",
+			in:       `"foo" in name.split(",")`,
+			newEnv:   cel.NewRecordsEnv,
+			want:     "? = ANY(string_to_array(name, ?))",
+			wantVars: []any{"foo", ","},
+		},
+		{
+			name:     "index operator with the split function",
+			in:       `name.split("/")[1] == "bar"`,
+			newEnv:   cel.NewRecordsEnv,
+			want:     "(string_to_array(name, ?))[?] = ?",
+			wantVars: []any{"/", int64(2), "bar"},
+		},
+		{
+			name:     "size function with the split function",
+			in:       `size(name.split("/")) == 2`,
+			newEnv:   cel.NewRecordsEnv,
+			want:     "cardinality(string_to_array(name, ?)) = ?",
+			wantVars: []any{"/", int64(2)},
+		},
+		{
+			name:     "values reordered by the dialect",
+			in:       `data.metadata.name.contains("foo")`,
+			newEnv:   cel.NewRecordsEnv,
+			want:     "POSITION(? IN (data->?->>?)) <> 0",
+			wantVars: []any{"foo", "metadata", "name"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env, err := test.newEnv()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, gotVars, err := ConvertWithVars(env, test.in, test.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("Mismatch (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(test.wantVars, gotVars); diff != "" {
+				t.Errorf("Mismatch in the vars (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestConvertWithVarsInGormStatements(t *testing.T) {
+	db, _ := gorm.Open(tests.DummyDialector{})
+
+	tests := []struct {
+		name string
+		in   string
+		opts []Option
+	}{{
+		name: "MySQL duration cast",
+		in:   `duration(data.spec.timeout) > duration("1h")`,
+		opts: []Option{WithDialect(MySQLDialect{})},
+	},
+		{
+			name: "MySQL regular expression",
+			in:   `data.metadata.name.matches("^a.?b")`,
+			opts: []Option{WithDialect(MySQLDialect{})},
+		},
+		{
+			name: "Postgres regular expression",
+			in:   `data.metadata.name.matches("^a.?b")`,
+		},
+	}
+
+	env, err := cel.NewRecordsEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sql, vars, err := ConvertWithVars(env, test.in, test.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// gorm binds the variables to the question marks in order, so
+			// question marks other than placeholders would shift them.
+			testDB := db.Where(sql, vars...)
+			testDB.Statement.Build("WHERE")
+
+			got := testDB.Statement.SQL.String()
+			if want := len(vars); strings.Count(got, "?") != want {
+				t.Errorf("Want %d placeholders, but got %q", want, got)
+			}
+
+			if diff := cmp.Diff(vars, testDB.Statement.Vars); diff != "" {
+				t.Errorf("Mismatch in the vars (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestConvertWithMapping(t *testing.T) {
+	env, err := celgo.NewEnv(
+		celgo.Types(&resultspb.RecordSummary{}),
+		celgo.Variable("kind", celgo.StringType),
+		celgo.Variable("payload", celgo.DynType),
+		celgo.Variable("summary", celgo.ObjectType("tekton.results.v1alpha2.RecordSummary")),
+		celgo.Variable("parent", celgo.ObjectType("tekton.results.v1alpha2.RecordSummary")),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mapping := Mapping{
+		"kind":    {Column: "record_type"},
+		"payload": {JSON: "body"},
+		"summary": {JSON: "summary_json"},
+		"parent":  {Prefix: "parent_"},
+	}
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{{
+		name: "column",
+		in:   `kind == "foo"`,
+		want: "record_type = 'foo'",
+	},
+		{
+			name: "JSON column",
+			in:   `payload.metadata.name == "foo"`,
+			want: `body @> '{"metadata":{"name":"foo"}}'::jsonb`,
+		},
+		{
+			name: "message stored in a JSON column",
+			in:   `summary.end_time > timestamp("2022-10-30T21:45:00Z") && summary.record.startsWith("foo")`,
+			want: "(summary_json->>'end_time')::TIMESTAMP WITH TIME ZONE > '2022-10-30T21:45:00Z'::TIMESTAMP WITH TIME ZONE AND (summary_json->>'record') LIKE 'foo' || '%' ESCAPE '!'",
+		},
+		{
+			name: "has macro on a message stored in a JSON column",
+			in:   `has(summary.end_time)`,
+			want: `jsonb_path_exists(summary_json, '$."end_time"')`,
+		},
+		{
+			name: "embedded struct",
+			in:   `parent.start_time < parent.end_time && has(parent.record)`,
+			want: "parent_start_time < parent_end_time AND parent_record IS NOT NULL",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Convert(env, test.in, WithMapping(mapping))
 			if err != nil {
 				t.Fatal(err)
 			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("Mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestConvertWithFunctions(t *testing.T) {
+	functions := []Function{{
+		Name:      "isFlaky",
+		Overloads: []celgo.FunctionOpt{celgo.Overload("is_flaky", nil, celgo.BoolType)},
+		SQL:       "recordsummary_status = 1 AND (annotations->>'attempts')::BIGINT > 1",
+	},
+		{
+			Name: "matchesGlob",
+			Overloads: []celgo.FunctionOpt{
+				celgo.MemberOverload("string_matches_glob_string", []*celgo.Type{celgo.StringType, celgo.StringType}, celgo.BoolType),
+			},
+			SQL: "$1 LIKE replace($2, '*', '%')",
+		},
+		{
+			Name: "secondsBetween",
+			Overloads: []celgo.FunctionOpt{
+				celgo.Overload("seconds_between_timestamp_timestamp", []*celgo.Type{celgo.TimestampType, celgo.TimestampType}, celgo.DoubleType),
+			},
+			Render: func(dialect Dialect, args []string) string {
+				if _, ok := dialect.(MySQLDialect); ok {
+					return fmt.Sprintf("TIMESTAMPDIFF(MICROSECOND, %s, %s) / 1000000", args[0], args[1])
+				}
+				return fmt.Sprintf("EXTRACT(EPOCH FROM %s - %s)", args[1], args[0])
+			},
+		},
+		{
+			Name:      "broken",
+			Overloads: []celgo.FunctionOpt{celgo.Overload("broken_string", []*celgo.Type{celgo.StringType}, celgo.BoolType)},
+			SQL:       "$1 = $2",
+		},
+	}
+
+	env, err := cel.NewResultsEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, function := range functions {
+		if env, err = env.Extend(function.EnvOption()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		in        string
+		want      string
+		wantMySQL string
+		wantVars  []any
+	}{{
+		name:      "function without arguments",
+		in:        `isFlaky() && summary.type == PIPELINE_RUN`,
+		want:      "(recordsummary_status = 1 AND (annotations->>'attempts')::BIGINT > 1) AND recordsummary_type = ?",
+		wantMySQL: "(recordsummary_status = 1 AND (annotations->>'attempts')::BIGINT > 1) AND recordsummary_type = ?",
+		wantVars:  []any{"tekton.dev/v1beta1.PipelineRun"},
+	},
+		{
+			name:      "receiver-style function",
+			in:        `annotations["repo"].matchesGlob("tektoncd/*")`,
+			want:      "((annotations->>?) LIKE replace(?, '*', '%'))",
+			wantMySQL: "((JSON_UNQUOTE(JSON_EXTRACT(annotations, ?))) LIKE replace(?, '*', '%'))",
+			wantVars:  []any{"repo", "tektoncd/*"},
+		},
+		{
+			name:      "function rendered by a callback",
+			in:        `secondsBetween(summary.start_time, summary.end_time) > 60.0`,
+			want:      "(EXTRACT(EPOCH FROM recordsummary_end_time - recordsummary_start_time)) > ?",
+			wantMySQL: "(TIMESTAMPDIFF(MICROSECOND, recordsummary_start_time, recordsummary_end_time) / 1000000) > ?",
+			wantVars:  []any{60.0},
+		},
+	}
 
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, vars, err := ConvertWithVars(env, test.in, WithFunctions(functions...))
+			if err != nil {
+				t.Fatal(err)
+			}
 			if diff := cmp.Diff(test.want, got); diff != "" {
 				t.Errorf("Mismatch (-want +got):\n%s", diff)
 			}
+			if diff := cmp.Diff(test.wantVars, vars); diff != "" {
+				t.Errorf("Mismatch in vars (-want +got):\n%s", diff)
+			}
+
+			got, _, err = ConvertWithVars(env, test.in, WithFunctions(functions...), WithDialect(MySQLDialect{}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(test.wantMySQL, got); diff != "" {
+				t.Errorf("Mismatch in the MySQL dialect (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("template referencing a missing argument", func(t *testing.T) {
+		_, err := Convert(env, `broken("foo")`, WithFunctions(functions...))
+		want := "unsupported CEL `broken` function statement at line 1, column 6: the SQL template references $2, but the function is called with 1 arguments"
+		if err == nil || err.Error() != want {
+			t.Errorf("Want error %q, but got %v", want, err)
+		}
+	})
+
+	t.Run("unregistered function", func(t *testing.T) {
+		if _, err := Convert(env, `isFlaky()`); !errors.Is(err, ErrUnsupportedExpression) {
+			t.Errorf("Want unsupported expression error, but got %v", err)
+		}
+	})
+}
+
+func TestConvertWithLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		in     string
+		limits Limits
+		want   string
+	}{{
+		name:   "too many nodes",
+		in:     `name == "a" || name == "b" || name == "c"`,
+		limits: Limits{MaxNodes: 10},
+		want:   "CEL filter too complex: it has 11 nodes, but at most 10 are allowed",
+	},
+		{
+			name:   "too deep",
+			in:     `data.spec.pipelineSpec.tasks.name == "build"`,
+			limits: Limits{MaxDepth: 5},
+			want:   "CEL filter too complex: it's nested 6 levels deep, but at most 5 levels are allowed",
+		},
+		{
+			name:   "too many regular expressions",
+			in:     `name.matches("^a") && data_type.matches("^b")`,
+			limits: Limits{MaxRegexps: 1},
+			want:   "CEL filter too complex: it matches 2 regular expressions, but at most 1 are allowed",
+		},
+		{
+			name:   "anchored regular expressions",
+			in:     `name.matches("^a") && matches(data_type, "b$")`,
+			limits: Limits{MaxUnanchoredRegexps: 1},
+			want:   "",
+		},
+		{
+			name:   "too many unanchored regular expressions",
+			in:     `name.matches("a") || data_type.matches("b")`,
+			limits: Limits{MaxUnanchoredRegexps: 1},
+			want:   "CEL filter too complex: it matches 2 regular expressions not anchored with ^, but at most 1 are allowed",
+		},
+		{
+			name:   "too many JSON extractions",
+			in:     `data.metadata.name.startsWith("foo") && has(data.status.completionTime) && data.spec.retries == 3`,
+			limits: Limits{MaxJSONExtractions: 1},
+			want:   "CEL filter too complex: it extracts 2 values from JSON documents, but at most 1 are allowed; comparing JSON values with constants using == doesn't count",
+		},
+		{
+			name:   "list too large",
+			in:     `name in ["a", "b", "c"]`,
+			limits: Limits{MaxListSize: 2},
+			want:   "CEL filter too complex: it has a list of 3 elements, but at most 2 are allowed",
+		},
+		{
+			name:   "folded regular expressions don't count",
+			in:     `"abc".matches("b") || name == "foo"`,
+			limits: Limits{MaxRegexps: 1, MaxUnanchoredRegexps: 1},
+			want:   "",
+		},
+		{
+			name:   "default limits",
+			in:     `data.metadata.name.matches("^foo") && data_type in ["a", "b"]`,
+			limits: DefaultLimits(),
+			want:   "",
+		},
+	}
+
+	env, err := cel.NewRecordsEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Convert(env, test.in, WithLimits(test.limits))
+			if test.want == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrFilterTooComplex) {
+				t.Fatalf("Want ErrFilterTooComplex, but got %v", err)
+			}
+
+			if diff := cmp.Diff(test.want, err.Error()); diff != "" {
+				t.Errorf("Mismatch (-want +got):\n%s", diff)
+			}
 		})
 	}
 }
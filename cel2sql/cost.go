@@ -0,0 +1,189 @@
+package cel2sql
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/cel-go/common/overloads"
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// ErrFilterTooComplex is a sentinel error returned when the CEL expression
+// exceeds the limits set by the WithLimits option.
+var ErrFilterTooComplex = errors.New("CEL filter too complex")
+
+// Cost estimates how expensive a CEL expression is to convert and how
+// expensive the generated SQL filter is to run.
+type Cost struct {
+	// Nodes is the number of nodes of the CEL AST, including the ones
+	// generated by the expansion of macros.
+	Nodes int
+
+	// Depth is the nesting depth of the CEL AST.
+	Depth int
+
+	// Regexps is the number of regular expressions matched by the filter.
+	Regexps int
+
+	// UnanchoredRegexps is the number of regular expressions that aren't
+	// anchored to the start of the string, which the database can't serve
+	// with indexes.
+	UnanchoredRegexps int
+
+	// JSONExtractions is the number of extractions of values from JSON
+	// documents that the database can't serve with indexes over whole JSON
+	// documents, unlike containment checks.
+	JSONExtractions int
+
+	// MaxListSize is the number of elements of the largest list, such as
+	// the ones of the in operator.
+	MaxListSize int
+}
+
+// Limits bounds the cost of the CEL expressions. Zero fields don't set a
+// limit. The evaluation of the constant subexpressions folded during the
+// conversion isn't bounded by the limits, but by a fixed budget.
+type Limits struct {
+	MaxNodes             int
+	MaxDepth             int
+	MaxRegexps           int
+	MaxUnanchoredRegexps int
+	MaxJSONExtractions   int
+	MaxListSize          int
+}
+
+// DefaultLimits returns limits suitable for the filters submitted by the users
+// of an API, which allow the reasonable filters while keeping the ones that
+// would scan a large table at length at bay.
+func DefaultLimits() Limits {
+	return Limits{
+		MaxNodes:             1000,
+		MaxDepth:             50,
+		MaxRegexps:           5,
+		MaxUnanchoredRegexps: 2,
+		MaxJSONExtractions:   20,
+		MaxListSize:          1000,
+	}
+}
+
+// check returns an ErrFilterTooComplex error explaining the first limit the
+// provided cost exceeds, if any.
+func (l Limits) check(cost Cost) error {
+	switch {
+	case exceeds(cost.Nodes, l.MaxNodes):
+		return fmt.Errorf("%w: it has %d nodes, but at most %d are allowed", ErrFilterTooComplex, cost.Nodes, l.MaxNodes)
+
+	case exceeds(cost.Depth, l.MaxDepth):
+		return fmt.Errorf("%w: it's nested %d levels deep, but at most %d levels are allowed", ErrFilterTooComplex, cost.Depth, l.MaxDepth)
+
+	case exceeds(cost.Regexps, l.MaxRegexps):
+		return fmt.Errorf("%w: it matches %d regular expressions, but at most %d are allowed", ErrFilterTooComplex, cost.Regexps, l.MaxRegexps)
+
+	case exceeds(cost.UnanchoredRegexps, l.MaxUnanchoredRegexps):
+		return fmt.Errorf("%w: it matches %d regular expressions not anchored with ^, but at most %d are allowed", ErrFilterTooComplex, cost.UnanchoredRegexps, l.MaxUnanchoredRegexps)
+
+	case exceeds(cost.JSONExtractions, l.MaxJSONExtractions):
+		return fmt.Errorf("%w: it extracts %d values from JSON documents, but at most %d are allowed; comparing JSON values with constants using == doesn't count", ErrFilterTooComplex, cost.JSONExtractions, l.MaxJSONExtractions)
+
+	case exceeds(cost.MaxListSize, l.MaxListSize):
+		return fmt.Errorf("%w: it has a list of %d elements, but at most %d are allowed", ErrFilterTooComplex, cost.MaxListSize, l.MaxListSize)
+	}
+	return nil
+}
+
+func exceeds(value, limit int) bool {
+	return limit > 0 && value > limit
+}
+
+// measureAST sets the number of nodes and the depth of the CEL AST.
+func (c *Cost) measureAST(expr *exprpb.Expr, depth int) {
+	if expr == nil {
+		return
+	}
+	c.Nodes++
+	if depth > c.Depth {
+		c.Depth = depth
+	}
+	for _, child := range childrenOf(expr) {
+		c.measureAST(child, depth+1)
+	}
+}
+
+// measureFunctions sets the number of regular expressions and the size of the
+// largest list of the folded CEL AST, so that the ones whose value is known in
+// advance don't count.
+func (c *Cost) measureFunctions(expr *exprpb.Expr) {
+	if expr == nil {
+		return
+	}
+	switch node := expr.GetExprKind().(type) {
+	case *exprpb.Expr_CallExpr:
+		if node.CallExpr.GetFunction() == overloads.Matches {
+			c.Regexps++
+			args := node.CallExpr.GetArgs()
+			pattern := args[len(args)-1].GetConstExpr().GetStringValue()
+			if !strings.HasPrefix(pattern, "^") && !strings.HasPrefix(pattern, `\A`) {
+				c.UnanchoredRegexps++
+			}
+		}
+
+	case *exprpb.Expr_ListExpr:
+		if size := len(node.ListExpr.GetElements()); size > c.MaxListSize {
+			c.MaxListSize = size
+		}
+	}
+	for _, child := range childrenOf(expr) {
+		c.measureFunctions(child)
+	}
+}
+
+// measureSQL sets the number of JSON extractions of the SQL expression.
+func (c *Cost) measureSQL(expr sqlExpr) {
+	switch expr.(type) {
+	case jsonExtract, jsonHasPath, jsonIsNull:
+		c.JSONExtractions++
+	}
+	mapChildren(expr, func(child sqlExpr) sqlExpr {
+		c.measureSQL(child)
+		return child
+	})
+}
+
+// childrenOf returns the subexpressions of the provided CEL expression.
+func childrenOf(expr *exprpb.Expr) []*exprpb.Expr {
+	switch node := expr.GetExprKind().(type) {
+	case *exprpb.Expr_SelectExpr:
+		return []*exprpb.Expr{node.SelectExpr.GetOperand()}
+
+	case *exprpb.Expr_CallExpr:
+		if target := node.CallExpr.GetTarget(); target != nil {
+			return append([]*exprpb.Expr{target}, node.CallExpr.GetArgs()...)
+		}
+		return node.CallExpr.GetArgs()
+
+	case *exprpb.Expr_ListExpr:
+		return node.ListExpr.GetElements()
+
+	case *exprpb.Expr_StructExpr:
+		children := []*exprpb.Expr{}
+		for _, entry := range node.StructExpr.GetEntries() {
+			if key := entry.GetMapKey(); key != nil {
+				children = append(children, key)
+			}
+			children = append(children, entry.GetValue())
+		}
+		return children
+
+	case *exprpb.Expr_ComprehensionExpr:
+		comprehension := node.ComprehensionExpr
+		return []*exprpb.Expr{
+			comprehension.GetIterRange(),
+			comprehension.GetAccuInit(),
+			comprehension.GetLoopCondition(),
+			comprehension.GetLoopStep(),
+			comprehension.GetResult(),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package cel2sql
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/google/cel-go/cel"
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// Function pairs a custom CEL function with its SQL translation. The function
+// must be declared in the CEL environment with EnvOption, in order to be type
+// checked, and made known to the conversion with WithFunctions.
+//
+// For instance, the following function checks whether a string matches a glob
+// pattern, as in annotations["repo"].matchesGlob("tektoncd/*"):
+//
+//	Function{
+//		Name: "matchesGlob",
+//		Overloads: []cel.FunctionOpt{
+//			cel.MemberOverload("string_matches_glob_string", []*cel.Type{cel.StringType, cel.StringType}, cel.BoolType),
+//		},
+//		SQL: "$1 LIKE replace($2, '*', '%')",
+//	}
+type Function struct {
+	// Name is the name of the CEL function.
+	Name string
+
+	// Overloads declares the signatures of the function.
+	Overloads []cel.FunctionOpt
+
+	// SQL is the template of the SQL translation of the function, in which
+	// $1, $2, ... are replaced with the translations of the arguments.
+	// Receiver-style calls, such as a.f(b), pass the receiver as the first
+	// argument. Values are bound to placeholders when converting with vars,
+	// but the template itself is inlined as is.
+	SQL string
+
+	// Render returns the SQL translation of the function in the provided
+	// dialect, given the translations of its arguments. It's used instead of
+	// the SQL template if set.
+	Render func(dialect Dialect, args []string) string
+}
+
+// EnvOption declares the function in a CEL environment.
+func (f Function) EnvOption() cel.EnvOption {
+	return cel.Function(f.Name, f.Overloads...)
+}
+
+// templateArgPattern matches the references to arguments in SQL templates.
+var templateArgPattern = regexp.MustCompile(`\$([0-9]+)`)
+
+// render returns the SQL translation of the function call with the provided
+// arguments. Its result is wrapped in parentheses, since the precedence of the
+// operators it may consist of is unknown.
+func (f *Function) render(dialect Dialect, args []string) string {
+	if f.Render != nil {
+		return "(" + f.Render(dialect, args) + ")"
+	}
+	sql := templateArgPattern.ReplaceAllStringFunc(f.SQL, func(ref string) string {
+		// The references are validated before the function is rendered.
+		n, _ := strconv.Atoi(ref[1:])
+		return args[n-1]
+	})
+	return "(" + sql + ")"
+}
+
+// interpretCustomFunction translates the call to a custom function.
+func (i *interpreter) interpretCustomFunction(id int64, function *Function, expr *exprpb.Expr_CallExpr) (sqlExpr, error) {
+	argExprs := expr.CallExpr.GetArgs()
+	if target := expr.CallExpr.GetTarget(); target != nil {
+		argExprs = append([]*exprpb.Expr{target}, argExprs...)
+	}
+
+	if function.Render == nil {
+		for _, ref := range templateArgPattern.FindAllStringSubmatch(function.SQL, -1) {
+			if n, err := strconv.Atoi(ref[1]); err != nil || n < 1 || n > len(argExprs) {
+				return nil, fmt.Errorf("%w: the SQL template references %s, but the function is called with %d arguments",
+					i.unsupportedExprError(id, fmt.Sprintf("`%s` function", function.Name)), ref[0], len(argExprs))
+			}
+		}
+	}
+
+	args := make([]sqlExpr, 0, len(argExprs))
+	for _, argExpr := range argExprs {
+		arg, err := i.interpretExpr(argExpr)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	return customCall{function, args}, nil
+}
@@ -0,0 +1,241 @@
+package cel2sql
+
+import (
+	"strconv"
+	"time"
+)
+
+// Dialect abstracts the SQL constructs whose syntax differs among database
+// engines. Operands are passed to the dialect as already translated SQL
+// expressions. JSON keys are passed as raw strings along with a ValueFunc, so
+// that dialects can embed them either as literals or as bound values.
+type Dialect interface {
+	// JSONExtract returns an expression that selects the value found at the
+	// provided path in the JSON document. The value is yielded as unquoted
+	// text if asText is true or as a JSON value otherwise. An empty path
+	// selects the document itself.
+	JSONExtract(document string, path []JSONPathElement, asText bool, value ValueFunc) string
+
+	// JSONHasPath returns a boolean expression that checks whether the path
+	// exists in the JSON document.
+	JSONHasPath(document string, path []JSONPathElement, value ValueFunc) string
+
+	// JSONIsNull returns a boolean expression that checks whether the value
+	// at the path of the JSON document is an explicit JSON null or, if negated,
+	// any other JSON value. Either way, it must yield NULL if the path doesn't
+	// exist.
+	JSONIsNull(document string, path []JSONPathElement, negated bool, value ValueFunc) string
+
+	// JSONArrayElements returns a table expression to be used in FROM clauses,
+	// which yields the elements of the JSON array as JSON values. Both the
+	// table and the column holding the elements must be named after alias.
+	JSONArrayElements(array, alias string) string
+
+	// JSONSize returns the number of elements of a JSON array, the number of
+	// keys of a JSON object or the number of characters of a JSON string.
+	JSONSize(document string) string
+
+	// JSONObjectSize returns the number of keys of a JSON object.
+	JSONObjectSize(document string) string
+
+	// StringLength returns the number of characters in the string.
+	StringLength(str string) string
+
+	// Contains returns a boolean expression that checks whether the string
+	// contains the substring.
+	Contains(str, substr string) string
+
+	// StartsWith returns a boolean expression that checks whether the string
+	// starts with the prefix. The pattern is the prefix with the wildcards of
+	// the LIKE operator escaped with the `!` character, which must be declared
+	// with an ESCAPE '!' clause.
+	StartsWith(str, prefix, pattern string) string
+
+	// EndsWith returns a boolean expression that checks whether the string
+	// ends with the suffix. The pattern is the suffix escaped as in
+	// StartsWith.
+	EndsWith(str, suffix, pattern string) string
+
+	// Matches returns a boolean expression that checks whether the string
+	// matches the regular expression, which is written in the syntax yielded
+	// by TranslateRegexp.
+	Matches(str, pattern string) string
+
+	// TranslateRegexp translates the RE2 regular expression into the syntax
+	// of the dialect. It returns an error if the regular expression can't be
+	// translated faithfully or is too expensive to match.
+	TranslateRegexp(pattern string) (string, error)
+
+	// Trim removes the leading and trailing ASCII whitespace of the string.
+	Trim(str string) string
+
+	// Replace replaces all occurrences of old in the string with new.
+	Replace(str, old, new string) string
+
+	// Substring returns the substring that starts at the one-based start
+	// position and has the provided length. An empty length selects the rest
+	// of the string.
+	Substring(str, start, length string) string
+
+	// Position returns the one-based position of the first occurrence of the
+	// substring in the string, or 0 if it isn't found.
+	Position(str, substr string) string
+
+	// Truncate rounds the number toward zero.
+	Truncate(number string) string
+
+	// Extract returns the numeric value of the provided part of a timestamp.
+	// Seconds and milliseconds are whole numbers (i.e. the seconds don't
+	// include the fraction and the milliseconds don't include the seconds).
+	Extract(part DatePart, timestamp string) string
+
+	// AtTimeZone converts the timestamp to the local time of the time zone,
+	// so that its parts can be extracted. The zone is either an IANA time zone
+	// name, such as America/Sao_Paulo, or a UTC offset, such as -03:00.
+	AtTimeZone(timestamp, zone string, value ValueFunc) string
+
+	// Now returns the current timestamp of the database.
+	Now() string
+
+	// AddDuration adds the duration to the timestamp. Negative durations are
+	// subtracted from the timestamp.
+	AddDuration(timestamp string, duration time.Duration, value ValueFunc) string
+
+	// Interval returns the SQL representation of the constant duration, which
+	// must be comparable to the values cast to DurationType.
+	Interval(duration time.Duration, value ValueFunc) string
+
+	// TimestampDiff returns the duration elapsed from the start timestamp to
+	// the end one, which must be comparable to the values cast to
+	// DurationType.
+	TimestampDiff(end, start string) string
+
+	// Cast converts the expression to the provided SQL type. Values cast to
+	// DurationType are strings in the format accepted by CEL durations, such
+	// as 1h30m.
+	Cast(expr string, to SQLType) string
+}
+
+// JSONContainmentDialect is implemented by dialects that can check whether a
+// JSON document contains another one, which allows comparisons of JSON values
+// with constants to be served by indexes over whole JSON documents.
+type JSONContainmentDialect interface {
+	// JSONContains returns a boolean expression that checks whether the JSON
+	// document contains the candidate one, which is made up of nested
+	// objects whose scalars must be found at the same paths in the document.
+	// Scalars must not match the elements of arrays found at their paths.
+	JSONContains(document, candidate string) string
+}
+
+// ASCIICaseDialect is implemented by dialects that can change the case of the
+// ASCII letters of strings while leaving the other characters untouched, as
+// required by the lowerAscii and upperAscii functions.
+type ASCIICaseDialect interface {
+	// LowerASCII converts the ASCII letters of the string to lower case.
+	LowerASCII(str string) string
+
+	// UpperASCII converts the ASCII letters of the string to upper case.
+	UpperASCII(str string) string
+}
+
+// ArrayDialect is implemented by dialects that support SQL arrays, which are
+// required by the translation of functions that return lists, such as split.
+type ArrayDialect interface {
+	// Split splits the string into an array of the substrings between the
+	// occurrences of the separator.
+	Split(str, sep string) string
+
+	// ArrayElement returns the element of the array at the one-based
+	// position.
+	ArrayElement(array, position string) string
+
+	// ArrayLength returns the number of elements of the array.
+	ArrayLength(array string) string
+
+	// ArrayContains returns a boolean expression that checks whether the
+	// element is in the array.
+	ArrayContains(array, elem string) string
+}
+
+// StringQuoter is implemented by dialects whose string literals need more
+// escaping than doubling the single quotes.
+type StringQuoter interface {
+	// QuoteString returns the string as a SQL string literal.
+	QuoteString(s string) string
+}
+
+// JSONPathElement is an element of a path within a JSON document, which is
+// either the key of an object or the zero-based index of an array element.
+type JSONPathElement struct {
+	Key string
+
+	// Index is the index of the array element, which is only meaningful if
+	// IsIndex is true.
+	Index   int64
+	IsIndex bool
+}
+
+// jsonKey returns the path element that selects the key of a JSON object.
+func jsonKey(key string) JSONPathElement {
+	return JSONPathElement{Key: key}
+}
+
+// jsonIndex returns the path element that selects the element of a JSON array
+// at the zero-based index.
+func jsonIndex(index int64) JSONPathElement {
+	return JSONPathElement{Index: index, IsIndex: true}
+}
+
+// ValueFunc returns the SQL representation of the provided value, which is
+// either an inlined literal or a placeholder bound to the value.
+type ValueFunc func(value any) string
+
+// DatePart enumerates the parts of a timestamp that can be extracted.
+type DatePart string
+
+const (
+	Year        DatePart = "YEAR"
+	Month       DatePart = "MONTH"
+	Day         DatePart = "DAY"
+	DayOfWeek   DatePart = "DOW"
+	DayOfYear   DatePart = "DOY"
+	Hour        DatePart = "HOUR"
+	Minute      DatePart = "MINUTE"
+	Second      DatePart = "SECOND"
+	Millisecond DatePart = "MILLISECOND"
+)
+
+// SQLType enumerates the SQL types that expressions can be cast to.
+type SQLType int
+
+const (
+	TimestampType SQLType = iota
+	IntType
+	DoubleType
+	BooleanType
+	DurationType
+	StringType
+)
+
+// equalityOperator returns the SQL operator that checks for equality or, if
+// negated, inequality.
+func equalityOperator(negated bool) string {
+	if negated {
+		return "<>"
+	}
+	return "="
+}
+
+// seconds returns the duration as a number of seconds, which is an integer
+// unless the duration has a fractional part.
+func seconds(duration time.Duration) any {
+	if duration%time.Second == 0 {
+		return int64(duration / time.Second)
+	}
+	return duration.Seconds()
+}
+
+// formatSeconds returns the duration as a decimal number of seconds.
+func formatSeconds(duration time.Duration) string {
+	return strconv.FormatFloat(duration.Seconds(), 'f', -1, 64)
+}
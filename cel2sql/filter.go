@@ -0,0 +1,190 @@
+package cel2sql
+
+import (
+	"sort"
+
+	"github.com/google/cel-go/cel"
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// Filter is a CEL expression compiled into a parameterized SQL filter, along
+// with the metadata gathered by its conversion. Filters are immutable, so they
+// can be reused across queries and shared by concurrent goroutines.
+type Filter struct {
+	sql       string
+	vars      []any
+	fields    []string
+	columns   []string
+	canonical string
+	cost      Cost
+
+	// callsNow indicates whether the SQL filter depends on the instant the
+	// now() function refers to.
+	callsNow bool
+}
+
+// Compile converts the CEL expression into a parameterized SQL filter, as
+// ConvertWithVars does, and returns it along with its metadata.
+func Compile(env *cel.Env, filters string, opts ...Option) (*Filter, error) {
+	canonical, err := Canonicalize(env, filters)
+	if err != nil {
+		return nil, err
+	}
+
+	interpreter, err := compile(env, filters, opts...)
+	if err != nil {
+		return nil, err
+	}
+	interpreter.parameterize = true
+
+	sql, err := interpreter.interpret()
+	if err != nil {
+		return nil, err
+	}
+	return &Filter{
+		sql:       sql,
+		vars:      interpreter.vars,
+		fields:    interpreter.referencedFields(),
+		columns:   interpreter.columns,
+		canonical: canonical,
+		cost:      interpreter.cost,
+		callsNow:  interpreter.callsNow,
+	}, nil
+}
+
+// SQL returns the SQL filter, whose values are replaced with placeholders.
+func (f *Filter) SQL() string {
+	return f.sql
+}
+
+// Vars returns the values bound to the placeholders of the SQL filter, in the
+// same order as the placeholders appear.
+func (f *Filter) Vars() []any {
+	return append([]any(nil), f.vars...)
+}
+
+// Fields returns the sorted paths of the CEL fields the filter refers to, such
+// as summary.status or data.metadata.name. Fields whose value doesn't affect
+// the outcome of the filter, such as the ones of constant subexpressions
+// folded during the conversion, aren't included.
+func (f *Filter) Fields() []string {
+	return append([]string(nil), f.fields...)
+}
+
+// Columns returns the sorted names of the columns the SQL filter refers to.
+func (f *Filter) Columns() []string {
+	return append([]string(nil), f.columns...)
+}
+
+// Canonical returns the canonical form of the CEL expression. See
+// Canonicalize.
+func (f *Filter) Canonical() string {
+	return f.canonical
+}
+
+// Cost returns the estimated cost of the filter. See Cost.
+func (f *Filter) Cost() Cost {
+	return f.cost
+}
+
+// referencedFields returns the sorted paths of the fields the folded CEL AST
+// refers to.
+func (i *interpreter) referencedFields() []string {
+	fields := map[string]bool{}
+	i.collectFields(i.checkedExpr.Expr, nil, fields)
+	return sortedKeys(fields)
+}
+
+// collectFields adds the paths of the longest chains of field selections over
+// variables found in the provided expression to fields. The iteration and
+// accumulation variables of the enclosing comprehensions are bound.
+func (i *interpreter) collectFields(expr *exprpb.Expr, bound []string, fields map[string]bool) {
+	switch node := expr.GetExprKind().(type) {
+	case *exprpb.Expr_IdentExpr, *exprpb.Expr_SelectExpr:
+		if path, ok := i.variablePathOf(expr, bound); ok {
+			fields[path] = true
+			return
+		}
+
+	case *exprpb.Expr_ComprehensionExpr:
+		comprehension := node.ComprehensionExpr
+		i.collectFields(comprehension.GetIterRange(), bound, fields)
+		i.collectFields(comprehension.GetAccuInit(), bound, fields)
+		bound = append(bound[:len(bound):len(bound)], comprehension.GetIterVar(), comprehension.GetAccuVar())
+		for _, child := range []*exprpb.Expr{comprehension.GetLoopCondition(), comprehension.GetLoopStep(), comprehension.GetResult()} {
+			i.collectFields(child, bound, fields)
+		}
+		return
+	}
+
+	for _, child := range childrenOf(expr) {
+		i.collectFields(child, bound, fields)
+	}
+}
+
+// variablePathOf returns the path of the provided chain of field selections if
+// it's rooted at a variable other than the bound ones. The field tested by the
+// has() macro is part of the path.
+func (i *interpreter) variablePathOf(expr *exprpb.Expr, bound []string) (string, bool) {
+	switch node := expr.GetExprKind().(type) {
+	case *exprpb.Expr_IdentExpr:
+		if reference, found := i.checkedExpr.ReferenceMap[expr.GetId()]; found && reference.GetValue() != nil {
+			return "", false
+		}
+		for _, variable := range bound {
+			if variable == node.IdentExpr.GetName() {
+				return "", false
+			}
+		}
+		return node.IdentExpr.GetName(), true
+
+	case *exprpb.Expr_SelectExpr:
+		path, ok := i.variablePathOf(node.SelectExpr.GetOperand(), bound)
+		return path + "." + node.SelectExpr.GetField(), ok
+	}
+	return "", false
+}
+
+// referencedColumns returns the sorted names of the columns the SQL expression
+// refers to, leaving out the aliases bound to the elements of JSON arrays.
+func referencedColumns(expr sqlExpr) []string {
+	columns := map[string]bool{}
+	collectColumns(expr, nil, columns)
+	return sortedKeys(columns)
+}
+
+func collectColumns(expr sqlExpr, aliases []string, columns map[string]bool) {
+	switch node := expr.(type) {
+	case column:
+		for _, alias := range aliases {
+			if alias == node.name {
+				return
+			}
+		}
+		columns[node.name] = true
+		return
+
+	case subquery:
+		collectColumns(node.array, aliases, columns)
+		aliases = append(aliases[:len(aliases):len(aliases)], node.alias)
+		collectColumns(node.selection, aliases, columns)
+		if node.where != nil {
+			collectColumns(node.where, aliases, columns)
+		}
+		return
+	}
+
+	mapChildren(expr, func(child sqlExpr) sqlExpr {
+		collectColumns(child, aliases, columns)
+		return child
+	})
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
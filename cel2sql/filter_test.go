@@ -0,0 +1,54 @@
+package cel2sql
+
+import (
+	"testing"
+
+	"cel2sql/cel"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCompile(t *testing.T) {
+	env, err := cel.NewRecordsEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filter, err := Compile(env, `data.spec.tasks.exists(t, t.name == name)&&data_type=="x"&&1+2==3`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff("EXISTS (SELECT 1 FROM jsonb_array_elements((data->?->?)) AS element1 WHERE (element1->>?) = name) AND type = ?", filter.SQL()); diff != "" {
+		t.Errorf("Mismatch in the SQL (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]any{"spec", "tasks", "name", "x"}, filter.Vars()); diff != "" {
+		t.Errorf("Mismatch in the vars (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"data.spec.tasks", "data_type", "name"}, filter.Fields()); diff != "" {
+		t.Errorf("Mismatch in the fields (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"data", "name", "type"}, filter.Columns()); diff != "" {
+		t.Errorf("Mismatch in the columns (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(`1 + 2 == 3 && data.spec.tasks.exists(t, t.name == name) && data_type == "x"`, filter.Canonical()); diff != "" {
+		t.Errorf("Mismatch in the canonical filter (-want +got):\n%s", diff)
+	}
+	wantCost := Cost{Nodes: 25, Depth: 7, JSONExtractions: 2}
+	if diff := cmp.Diff(wantCost, filter.Cost()); diff != "" {
+		t.Errorf("Mismatch in the cost (-want +got):\n%s", diff)
+	}
+
+	t.Run("vars are copied", func(t *testing.T) {
+		filter.Vars()[0] = "status"
+		if got := filter.Vars()[0]; got != "spec" {
+			t.Errorf("Want %q, but got %q", "spec", got)
+		}
+	})
+
+	t.Run("invalid filter", func(t *testing.T) {
+		if _, err := Compile(env, `name ==`); err == nil {
+			t.Error("Want error, but got nil")
+		}
+	})
+}
@@ -0,0 +1,357 @@
+package cel2sql
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/operators"
+	"github.com/google/cel-go/common/overloads"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// maxFoldingCost is the runtime cost, as measured by cel-go, that the
+// evaluation of the closed subexpressions of a CEL expression may add up to.
+// Closed comprehensions can be made arbitrarily expensive to evaluate by
+// nesting them, so the subexpressions left to evaluate once it's spent aren't
+// folded.
+const maxFoldingCost = 100000
+
+// folder folds the constant subexpressions of a checked CEL expression before
+// it's interpreted, so that the generated SQL doesn't compute them and the
+// expressions that can't be translated, but whose value is known in advance,
+// become convertible. Closed subexpressions, which don't refer to variables,
+// are evaluated by cel-go, and the logical operators and conditional
+// expressions whose outcome is decided by a constant operand are
+// short-circuited.
+type folder struct {
+	env         *cel.Env
+	checkedExpr *exprpb.CheckedExpr
+
+	// functions holds the custom functions, which are translated into SQL
+	// instead of being evaluated.
+	functions map[string]*Function
+
+	// budget is the runtime cost left for the evaluation of closed
+	// subexpressions.
+	budget uint64
+}
+
+// foldConstants returns a copy of the checked expression with its constant
+// subexpressions folded.
+func foldConstants(env *cel.Env, checkedExpr *exprpb.CheckedExpr, functions map[string]*Function) (*exprpb.CheckedExpr, error) {
+	f := &folder{
+		env:         env,
+		checkedExpr: proto.Clone(checkedExpr).(*exprpb.CheckedExpr),
+		functions:   functions,
+		budget:      maxFoldingCost,
+	}
+	expr, err := f.fold(f.checkedExpr.Expr)
+	if err != nil {
+		return nil, err
+	}
+	f.checkedExpr.Expr = expr
+	return f.checkedExpr, nil
+}
+
+// fold returns the folded expression. The children of the expression are
+// folded in place.
+func (f *folder) fold(expr *exprpb.Expr) (*exprpb.Expr, error) {
+	if f.isClosed(expr, nil) && !isLiteral(expr) {
+		constant, ok, err := f.evaluate(expr)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return constant, nil
+		}
+	}
+
+	// children points to the fields holding the subexpressions, which are
+	// replaced with their folded form.
+	children := []**exprpb.Expr{}
+	switch node := expr.GetExprKind().(type) {
+	case *exprpb.Expr_SelectExpr:
+		children = append(children, &node.SelectExpr.Operand)
+
+	case *exprpb.Expr_CallExpr:
+		if node.CallExpr.GetTarget() != nil {
+			children = append(children, &node.CallExpr.Target)
+		}
+		for k := range node.CallExpr.GetArgs() {
+			children = append(children, &node.CallExpr.Args[k])
+		}
+
+	case *exprpb.Expr_ListExpr:
+		for k := range node.ListExpr.GetElements() {
+			children = append(children, &node.ListExpr.Elements[k])
+		}
+
+	case *exprpb.Expr_StructExpr:
+		for _, entry := range node.StructExpr.GetEntries() {
+			if key, ok := entry.GetKeyKind().(*exprpb.Expr_CreateStruct_Entry_MapKey); ok {
+				children = append(children, &key.MapKey)
+			}
+			children = append(children, &entry.Value)
+		}
+
+	case *exprpb.Expr_ComprehensionExpr:
+		comprehension := node.ComprehensionExpr
+		children = append(children,
+			&comprehension.IterRange,
+			&comprehension.AccuInit,
+			&comprehension.LoopCondition,
+			&comprehension.LoopStep,
+			&comprehension.Result,
+		)
+	}
+	for _, child := range children {
+		folded, err := f.fold(*child)
+		if err != nil {
+			return nil, err
+		}
+		*child = folded
+	}
+
+	if call := expr.GetCallExpr(); call != nil {
+		return f.shortCircuit(expr, call), nil
+	}
+	return expr, nil
+}
+
+// shortCircuit simplifies the logical operators with a constant operand and
+// the conditional expressions with a constant condition. The remaining operand
+// replaces the expression only if it has the same type, so that dyn operands
+// keep being interpreted as booleans.
+func (f *folder) shortCircuit(expr *exprpb.Expr, call *exprpb.Expr_Call) *exprpb.Expr {
+	switch call.GetFunction() {
+	case operators.LogicalAnd, operators.LogicalOr:
+		// The value that decides the outcome of the operator.
+		decisive := call.GetFunction() == operators.LogicalOr
+		for k, arg := range call.GetArgs() {
+			value, ok := boolConstantOf(arg)
+			if !ok {
+				continue
+			}
+			if value == decisive {
+				return f.replaceWithConstant(expr, &exprpb.Constant{ConstantKind: &exprpb.Constant_BoolValue{BoolValue: decisive}})
+			}
+			if other := call.GetArgs()[1-k]; f.hasTypeOf(other, expr) {
+				return other
+			}
+		}
+
+	case operators.Conditional:
+		condition, ok := boolConstantOf(call.GetArgs()[0])
+		if !ok {
+			break
+		}
+		branch := call.GetArgs()[2]
+		if condition {
+			branch = call.GetArgs()[1]
+		}
+		if f.hasTypeOf(branch, expr) {
+			return branch
+		}
+	}
+	return expr
+}
+
+// isClosed returns true if the provided expression doesn't refer to variables
+// other than the bound iteration and accumulation variables of the enclosing
+// comprehensions, nor to functions whose value depends on the time of the
+// evaluation or which are translated into SQL by the custom functions.
+func (f *folder) isClosed(expr *exprpb.Expr, bound []string) bool {
+	switch node := expr.GetExprKind().(type) {
+	case *exprpb.Expr_ConstExpr:
+		return true
+
+	case *exprpb.Expr_IdentExpr:
+		if reference, found := f.checkedExpr.ReferenceMap[expr.GetId()]; found && reference.GetValue() != nil {
+			return true
+		}
+		for _, name := range bound {
+			if name == node.IdentExpr.GetName() {
+				return true
+			}
+		}
+		return false
+
+	case *exprpb.Expr_SelectExpr:
+		return f.isClosed(node.SelectExpr.GetOperand(), bound)
+
+	case *exprpb.Expr_CallExpr:
+		function := node.CallExpr.GetFunction()
+		if _, found := f.functions[function]; found || function == "now" {
+			return false
+		}
+		if target := node.CallExpr.GetTarget(); target != nil && !f.isClosed(target, bound) {
+			return false
+		}
+		return f.areClosed(node.CallExpr.GetArgs(), bound)
+
+	case *exprpb.Expr_ListExpr:
+		return f.areClosed(node.ListExpr.GetElements(), bound)
+
+	case *exprpb.Expr_StructExpr:
+		for _, entry := range node.StructExpr.GetEntries() {
+			if key := entry.GetMapKey(); key != nil && !f.isClosed(key, bound) {
+				return false
+			}
+			if !f.isClosed(entry.GetValue(), bound) {
+				return false
+			}
+		}
+		return true
+
+	case *exprpb.Expr_ComprehensionExpr:
+		comprehension := node.ComprehensionExpr
+		if !f.isClosed(comprehension.GetIterRange(), bound) || !f.isClosed(comprehension.GetAccuInit(), bound) {
+			return false
+		}
+		bound = append(bound[:len(bound):len(bound)], comprehension.GetIterVar(), comprehension.GetAccuVar())
+		return f.areClosed([]*exprpb.Expr{comprehension.GetLoopCondition(), comprehension.GetLoopStep(), comprehension.GetResult()}, bound)
+	}
+	return false
+}
+
+func (f *folder) areClosed(exprs []*exprpb.Expr, bound []string) bool {
+	for _, expr := range exprs {
+		if !f.isClosed(expr, bound) {
+			return false
+		}
+	}
+	return true
+}
+
+// evaluate evaluates the provided closed expression and returns the constant
+// holding its value. Expressions whose evaluation fails are left to the
+// interpreter, and so are the ones that yield values without a constant
+// counterpart, such as lists and maps, or dyn values, which are interpreted
+// as JSON values. The cost of the evaluation is taken out of the budget, and
+// evaluations that would exceed it are cancelled. Expressions that yield NaN
+// or infinities are rejected, since SQL has no literals for them and computing
+// them would fail the query instead.
+func (f *folder) evaluate(expr *exprpb.Expr) (*exprpb.Expr, bool, error) {
+	if f.budget == 0 || !isFoldableType(f.checkedExpr.TypeMap[expr.GetId()]) {
+		return nil, false, nil
+	}
+
+	ast := cel.CheckedExprToAst(&exprpb.CheckedExpr{
+		ReferenceMap: f.checkedExpr.GetReferenceMap(),
+		TypeMap:      f.checkedExpr.GetTypeMap(),
+		SourceInfo:   f.checkedExpr.GetSourceInfo(),
+		Expr:         expr,
+	})
+	program, err := f.env.Program(ast, cel.CostLimit(f.budget))
+	if err != nil {
+		return nil, false, nil
+	}
+	value, details, err := program.Eval(map[string]any{})
+	if cost := details.ActualCost(); cost != nil && *cost < f.budget {
+		f.budget -= *cost
+	} else {
+		f.budget = 0
+	}
+	if err != nil {
+		return nil, false, nil
+	}
+
+	if double, ok := value.(types.Double); ok && (math.IsNaN(float64(double)) || math.IsInf(float64(double), 0)) {
+		return nil, false, fmt.Errorf("%w: it evaluates to %v", unsupportedExprErrorAt(f.checkedExpr.GetSourceInfo(), expr.GetId(), "non-finite double"), double)
+	}
+	constant, ok := constantOf(value)
+	if !ok {
+		return nil, false, nil
+	}
+	return f.replaceWithConstant(expr, constant), true, nil
+}
+
+// replaceWithConstant returns a constant expression with the ID of the provided
+// one, so that it keeps its type and source position.
+func (f *folder) replaceWithConstant(expr *exprpb.Expr, constant *exprpb.Constant) *exprpb.Expr {
+	delete(f.checkedExpr.ReferenceMap, expr.GetId())
+	return &exprpb.Expr{Id: expr.GetId(), ExprKind: &exprpb.Expr_ConstExpr{ConstExpr: constant}}
+}
+
+// hasTypeOf returns true if both expressions have the same type.
+func (f *folder) hasTypeOf(expr, typeOf *exprpb.Expr) bool {
+	theType, found := f.checkedExpr.TypeMap[expr.GetId()]
+	return found && proto.Equal(theType, f.checkedExpr.TypeMap[typeOf.GetId()])
+}
+
+// isLiteral returns true if the provided expression is a constant, or a
+// timestamp or duration conversion of a constant string, which are already as
+// simple as they get.
+func isLiteral(expr *exprpb.Expr) bool {
+	if expr.GetConstExpr() != nil {
+		return true
+	}
+	call := expr.GetCallExpr()
+	switch call.GetFunction() {
+	case overloads.TypeConvertTimestamp, overloads.TypeConvertDuration:
+		return len(call.GetArgs()) == 1 && call.GetArgs()[0].GetConstExpr() != nil
+	}
+	return false
+}
+
+// isFoldableType returns true if values of the provided type can be held by
+// constants supported by the interpreter.
+func isFoldableType(theType *exprpb.Type) bool {
+	switch kind := theType.GetTypeKind().(type) {
+	case *exprpb.Type_Primitive:
+		return kind.Primitive != exprpb.Type_BYTES
+
+	case *exprpb.Type_WellKnown:
+		return kind.WellKnown == exprpb.Type_TIMESTAMP || kind.WellKnown == exprpb.Type_DURATION
+
+	case *exprpb.Type_Null:
+		return true
+	}
+	return false
+}
+
+// constantOf returns the constant holding the provided CEL value.
+func constantOf(value ref.Val) (*exprpb.Constant, bool) {
+	switch value := value.(type) {
+	case types.Null:
+		return &exprpb.Constant{ConstantKind: &exprpb.Constant_NullValue{}}, true
+
+	case types.Bool:
+		return &exprpb.Constant{ConstantKind: &exprpb.Constant_BoolValue{BoolValue: bool(value)}}, true
+
+	case types.Int:
+		return &exprpb.Constant{ConstantKind: &exprpb.Constant_Int64Value{Int64Value: int64(value)}}, true
+
+	case types.Uint:
+		return &exprpb.Constant{ConstantKind: &exprpb.Constant_Uint64Value{Uint64Value: uint64(value)}}, true
+
+	case types.Double:
+		return &exprpb.Constant{ConstantKind: &exprpb.Constant_DoubleValue{DoubleValue: float64(value)}}, true
+
+	case types.String:
+		return &exprpb.Constant{ConstantKind: &exprpb.Constant_StringValue{StringValue: string(value)}}, true
+
+	case types.Timestamp:
+		return &exprpb.Constant{ConstantKind: &exprpb.Constant_TimestampValue{TimestampValue: timestamppb.New(value.Time)}}, true
+
+	case types.Duration:
+		return &exprpb.Constant{ConstantKind: &exprpb.Constant_DurationValue{DurationValue: durationpb.New(value.Duration)}}, true
+	}
+	return nil, false
+}
+
+// boolConstantOf returns the value of the provided expression if it's a boolean
+// constant.
+func boolConstantOf(expr *exprpb.Expr) (bool, bool) {
+	constant, ok := expr.GetConstExpr().GetConstantKind().(*exprpb.Constant_BoolValue)
+	if !ok {
+		return false, false
+	}
+	return constant.BoolValue, true
+}
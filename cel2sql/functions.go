@@ -7,99 +7,206 @@ import (
 	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
 )
 
-func (i *interpreter) interpretFunctionCallExpr(id int64, expr *exprpb.Expr_CallExpr) error {
+func (i *interpreter) interpretFunctionCallExpr(id int64, expr *exprpb.Expr_CallExpr) (sqlExpr, error) {
 	function := expr.CallExpr.GetFunction()
 	switch function {
 	case overloads.Contains:
-		return i.interpretContainsFunction(expr)
+		return i.translateIntoCall(expr, containsFunc)
 
 	case overloads.EndsWith:
-		return i.translateIntoBinaryCall(expr, "LIKE '%' ||")
+		return i.translateIntoCall(expr, endsWithFunc)
 
 	case overloads.TimeGetDate:
-		return i.translateIntoExtractFunctionCall(expr, "DAY", false)
+		return i.translateIntoExtractFunctionCall(expr, Day, false)
 
 	case overloads.TimeGetDayOfMonth:
-		return i.translateIntoExtractFunctionCall(expr, "DAY", true)
+		return i.translateIntoExtractFunctionCall(expr, Day, true)
 
 	case overloads.TimeGetDayOfWeek:
-		return i.translateIntoExtractFunctionCall(expr, "DOW", false)
+		return i.translateIntoExtractFunctionCall(expr, DayOfWeek, false)
 
 	case overloads.TimeGetDayOfYear:
-		return i.translateIntoExtractFunctionCall(expr, "DOY", true)
+		return i.translateIntoExtractFunctionCall(expr, DayOfYear, true)
 
 	case overloads.TimeGetFullYear:
-		return i.translateIntoExtractFunctionCall(expr, "YEAR", false)
+		return i.translateIntoExtractFunctionCall(expr, Year, false)
+
+	case overloads.TimeGetMonth:
+		return i.translateIntoExtractFunctionCall(expr, Month, true)
+
+	case overloads.TimeGetHours:
+		return i.translateIntoExtractFunctionCall(expr, Hour, false)
+
+	case overloads.TimeGetMinutes:
+		return i.translateIntoExtractFunctionCall(expr, Minute, false)
+
+	case overloads.TimeGetSeconds:
+		return i.translateIntoExtractFunctionCall(expr, Second, false)
+
+	case overloads.TimeGetMilliseconds:
+		return i.translateIntoExtractFunctionCall(expr, Millisecond, false)
+
+	case overloads.Size:
+		return i.interpretSizeFunction(id, expr)
 
 	case overloads.StartsWith:
-		return i.interpretStartsWithFunction(expr)
+		return i.translateIntoCall(expr, startsWithFunc)
 
 	case overloads.Matches:
-		return i.translateIntoBinaryCall(expr, "~")
+		return i.interpretMatchesFunction(expr)
 
 	case overloads.TypeConvertTimestamp:
 		return i.interpretTimestampFunction(expr)
 
-	}
+	case overloads.TypeConvertInt, overloads.TypeConvertUint, overloads.TypeConvertDouble,
+		overloads.TypeConvertString, overloads.TypeConvertBool, overloads.TypeConvertDuration:
+		return i.interpretConversionFunction(id, expr)
 
-	return i.unsupportedExprError(id, fmt.Sprintf("`%s` function", function))
-}
+	case "now":
+		return i.interpretNowFunction()
+
+	case lowerASCIIFunction:
+		return i.interpretASCIICaseFunction(id, expr, lowerFunc)
+
+	case upperASCIIFunction:
+		return i.interpretASCIICaseFunction(id, expr, upperFunc)
+
+	case trimFunction:
+		return i.translateIntoCall(expr, trimFunc)
+
+	case replaceFunction:
+		return i.interpretReplaceFunction(id, expr)
+
+	case substringFunction:
+		return i.interpretSubstringFunction(expr)
+
+	case indexOfFunction:
+		return i.interpretIndexOfFunction(expr)
+
+	case splitFunction:
+		return i.interpretSplitFunction(id, expr)
 
-func (i *interpreter) interpretContainsFunction(expr *exprpb.Expr_CallExpr) error {
-	fmt.Fprintf(&i.query, "POSITION(")
-	if err := i.interpretExpr(expr.CallExpr.Args[0]); err != nil {
-		return err
 	}
-	fmt.Fprintf(&i.query, " IN ")
-	if err := i.interpretExpr(expr.CallExpr.GetTarget()); err != nil {
-		return err
+
+	if custom, found := i.functions[function]; found {
+		return i.interpretCustomFunction(id, custom, expr)
 	}
-	i.query.WriteString(") <> 0")
-	return nil
+	return nil, i.unsupportedExprError(id, fmt.Sprintf("`%s` function", function))
 }
 
-func (i *interpreter) interpretStartsWithFunction(expr *exprpb.Expr_CallExpr) error {
-	if err := i.translateIntoBinaryCall(expr, "LIKE"); err != nil {
-		return err
+// targetAndArgs returns the target and the arguments of the function call,
+// regardless of whether it was written in the receiver style (`a.f(b)`) or in
+// the global style (`f(a, b)`).
+func targetAndArgs(expr *exprpb.Expr_CallExpr) (*exprpb.Expr, []*exprpb.Expr) {
+	if target := expr.CallExpr.GetTarget(); target != nil {
+		return target, expr.CallExpr.GetArgs()
 	}
-	i.query.WriteString(" || '%'")
-	return nil
+	return expr.CallExpr.Args[0], expr.CallExpr.Args[1:]
 }
 
-func (i *interpreter) translateIntoBinaryCall(expr *exprpb.Expr_CallExpr, infixTerm string) error {
-	if err := i.interpretExpr(expr.CallExpr.GetTarget()); err != nil {
-		return err
+// interpretSizeFunction translates the size function according to the type of
+// its argument. Since the type of JSON values is only known at runtime, dyn
+// arguments are dispatched on the JSON type of the value.
+func (i *interpreter) interpretSizeFunction(id int64, expr *exprpb.Expr_CallExpr) (sqlExpr, error) {
+	arg, _ := targetAndArgs(expr)
+
+	var (
+		function function
+		sql      sqlExpr
+		err      error
+	)
+	switch {
+	case i.isDyn(arg):
+		function = jsonSizeFunc
+		sql, err = i.interpretJSONExpr(arg)
+
+	case i.isMap(arg):
+		function = jsonObjectSizeFunc
+		sql, err = i.interpretExpr(arg)
+
+	case i.isString(arg):
+		function = stringLengthFunc
+		sql, err = i.interpretExpr(arg)
+
+	case i.isArray(arg):
+		function = arrayLengthFunc
+		sql, err = i.interpretExpr(arg)
+
+	default:
+		return nil, i.unsupportedExprError(id, "`size` function")
 	}
-	fmt.Fprintf(&i.query, " %s ", infixTerm)
-	if err := i.interpretExpr(expr.CallExpr.Args[0]); err != nil {
-		return err
+	if err != nil {
+		return nil, err
 	}
+	return call{function, []sqlExpr{sql}}, nil
+}
 
-	return nil
+// translateIntoCall translates function calls such as `a.startsWith(b)` into
+// a call to the provided dialect function, passing the target followed by the
+// arguments.
+func (i *interpreter) translateIntoCall(expr *exprpb.Expr_CallExpr, function function) (sqlExpr, error) {
+	target, args := targetAndArgs(expr)
+	sql, err := i.interpretExpr(target)
+	if err != nil {
+		return nil, err
+	}
+	call := call{function, []sqlExpr{sql}}
+	for _, arg := range args {
+		sql, err := i.interpretExpr(arg)
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, sql)
+	}
+	return call, nil
 }
 
-func (i *interpreter) translateIntoExtractFunctionCall(expr *exprpb.Expr_CallExpr, field string, decrementReturnValue bool) error {
-	if decrementReturnValue {
-		i.query.WriteString("(")
+// translateIntoExtractFunctionCall translates the CEL timestamp accessors,
+// which take an optional time zone argument, into the extraction of the
+// provided part of the timestamp. Since the CEL accessors are zero-based for
+// some parts, their return values may need to be decremented.
+func (i *interpreter) translateIntoExtractFunctionCall(expr *exprpb.Expr_CallExpr, part DatePart, decrementReturnValue bool) (sqlExpr, error) {
+	target, args := targetAndArgs(expr)
+	timestamp, err := i.interpretExpr(target)
+	if err != nil {
+		return nil, err
 	}
-	fmt.Fprintf(&i.query, "EXTRACT(%s FROM ", field)
-	if err := i.interpretExpr(expr.CallExpr.GetTarget()); err != nil {
-		return err
+	if i.isDyn(target) {
+		timestamp = coerceWellKnownType(timestamp, exprpb.Type_TIMESTAMP)
 	}
-	if i.isDyn(expr.CallExpr.Target) {
-		i.coerceWellKnownType(exprpb.Type_TIMESTAMP)
+
+	if len(args) > 0 {
+		zone, err := i.timeZoneOf(args[0])
+		if err != nil {
+			return nil, err
+		}
+		timestamp = atTimeZone{timestamp, zone}
 	}
-	i.query.WriteString(")")
+
 	if decrementReturnValue {
-		i.query.WriteString(" - 1)")
+		return paren{binaryExpr{"-", extract{part, timestamp}, raw{"1"}}}, nil
+	}
+	return extract{part, timestamp}, nil
+}
+
+// timeZoneOf returns the time zone passed to a timestamp accessor, which must
+// be a valid constant.
+func (i *interpreter) timeZoneOf(expr *exprpb.Expr) (string, error) {
+	constant := expr.GetConstExpr()
+	if _, ok := constant.GetConstantKind().(*exprpb.Constant_StringValue); !ok {
+		return "", i.unsupportedExprError(expr.GetId(), "non-constant time zone")
+	}
+	zone := constant.GetStringValue()
+	if _, err := loadLocation(zone); err != nil {
+		return "", fmt.Errorf("%w: %v", i.unsupportedExprError(expr.GetId(), "time zone"), err)
 	}
-	return nil
+	return zone, nil
 }
 
-func (i *interpreter) interpretTimestampFunction(expr *exprpb.Expr_CallExpr) error {
-	if err := i.interpretExpr(expr.CallExpr.Args[0]); err != nil {
-		return err
+func (i *interpreter) interpretTimestampFunction(expr *exprpb.Expr_CallExpr) (sqlExpr, error) {
+	arg, err := i.interpretExpr(expr.CallExpr.Args[0])
+	if err != nil {
+		return nil, err
 	}
-	i.query.WriteString("::TIMESTAMP WITH TIME ZONE")
-	return nil
+	return cast{arg, TimestampType}, nil
 }
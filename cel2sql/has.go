@@ -0,0 +1,63 @@
+package cel2sql
+
+import (
+	"fmt"
+	"strings"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// interpretHasMacro translates the has() macro, which is represented as a
+// test-only select expression. Fields of JSON objects (dyn values, maps and
+// messages stored in JSON columns) are checked for key existence, whereas
+// fields mapped to columns are checked for NOT NULL values.
+func (i *interpreter) interpretHasMacro(id int64, expr *exprpb.Expr_SelectExpr) (sqlExpr, error) {
+	field := expr.SelectExpr.GetField()
+	operand := expr.SelectExpr.GetOperand()
+	selectExpr := &exprpb.Expr{Id: id, ExprKind: &exprpb.Expr_SelectExpr{
+		SelectExpr: &exprpb.Expr_Select{Operand: operand, Field: field},
+	}}
+	name, isMapped := i.mappedColumnOf(selectExpr)
+	switch {
+	case isMapped:
+		return postfixExpr{column{name}, "IS NOT NULL"}, nil
+
+	case i.isMap(operand):
+		// Maps stored in JSON columns, such as summary.annotations.
+		column, err := i.interpretExpr(operand)
+		if err != nil {
+			return nil, err
+		}
+		return jsonHasPath{column, []JSONPathElement{jsonKey(field)}}, nil
+
+	case i.isDyn(operand), i.isInJSONColumn(operand):
+		root, path, err := i.jsonPathOf(operand)
+		if err != nil {
+			return nil, err
+		}
+		return jsonHasPath{column{root}, append(path, jsonKey(field))}, nil
+	}
+
+	root, _, err := i.jsonPathOf(operand)
+	if err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("%w. %s: not recognized field.", i.unsupportedExprError(id, "has"), root)
+}
+
+// jsonPath returns a SQL/JSON path expression that selects the provided
+// sequence of keys and array indices starting from the root of the document.
+func jsonPath(elems []JSONPathElement) string {
+	var path strings.Builder
+	path.WriteString("$")
+	for _, elem := range elems {
+		if elem.IsIndex {
+			fmt.Fprintf(&path, "[%d]", elem.Index)
+			continue
+		}
+		key := strings.ReplaceAll(elem.Key, `\`, `\\`)
+		key = strings.ReplaceAll(key, `"`, `\"`)
+		fmt.Fprintf(&path, `."%s"`, key)
+	}
+	return path.String()
+}
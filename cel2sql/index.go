@@ -1,25 +1,11 @@
 package cel2sql
 
 import (
-	"fmt"
-
+	"github.com/google/cel-go/checker/decls"
 	"github.com/google/cel-go/common/operators"
 	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
 )
 
-func (i *interpreter) mayBeTranslatedIntoJSONPathContainsExpression(arg1 *exprpb.Expr, function string, arg2 *exprpb.Expr) bool {
-	constExpr := arg2.GetConstExpr()
-	if constExpr == nil {
-		return false
-	}
-	if _, ok := constExpr.GetConstantKind().(*exprpb.Constant_StringValue); !ok {
-		return false
-	}
-	return isIndexExpr(arg1) &&
-		function == operators.Equals &&
-		!i.isDyn(arg1.GetCallExpr().Args[0])
-}
-
 func isIndexExpr(expr *exprpb.Expr) bool {
 	if callExpr := expr.GetCallExpr(); callExpr != nil && isIndexOperator(callExpr.GetFunction()) {
 		return true
@@ -31,35 +17,38 @@ func isIndexOperator(symbol string) bool {
 	return symbol == operators.Index
 }
 
-func (i *interpreter) translateIntoJSONPathContainsExpression(arg1 *exprpb.Expr, arg2 *exprpb.Expr) error {
-	callExprArgs := arg1.GetCallExpr().GetArgs()
-	key := callExprArgs[len(callExprArgs)-1]
-	for _, expr := range callExprArgs[0 : len(callExprArgs)-1] {
-		if err := i.interpretExpr(expr); err != nil {
-			return err
-		}
-	}
-
-	fmt.Fprintf(&i.query, ` @> '{"%s":"%s"}'::jsonb`,
-		key.GetConstExpr().GetStringValue(),
-		arg2.GetConstExpr().GetStringValue())
-
-	return nil
-}
-
-func (i *interpreter) interpretIndexExpr(id int64, expr *exprpb.Expr_CallExpr) error {
+func (i *interpreter) interpretIndexExpr(id int64, expr *exprpb.Expr_CallExpr) (sqlExpr, error) {
 	args := expr.CallExpr.GetArgs()
-	if args[0].GetSelectExpr() != nil {
-		return i.interpretSelectExpr(id, args[0].ExprKind.(*exprpb.Expr_SelectExpr), args[1])
-	}
-	if args[0].GetIdentExpr() != nil {
-		if err := i.interpretExpr(args[0]); err != nil {
-			return err
+	switch {
+	case i.isDyn(args[0]):
+		root, path, err := i.jsonPathOf(&exprpb.Expr{Id: id, ExprKind: expr})
+		if err != nil {
+			return nil, err
 		}
+		return translateToJSONAccessors(root, path), nil
 
-		fmt.Fprintf(&i.query, "->>'%s'", args[1].GetConstExpr().GetStringValue())
+	case i.isMap(args[0]):
+		// Maps stored in JSON columns, such as annotations.
+		document, err := i.interpretExpr(args[0])
+		if err != nil {
+			return nil, err
+		}
+		key, err := i.jsonPathElementOf(args[1])
+		if err != nil {
+			return nil, err
+		}
+		return jsonExtract{document: document, path: []JSONPathElement{key}, asText: true}, nil
 
-		return nil
+	case i.isArray(args[0]):
+		array, err := i.interpretExpr(args[0])
+		if err != nil {
+			return nil, err
+		}
+		index, err := i.interpretCoercedArg(args[1], decls.Int)
+		if err != nil {
+			return nil, err
+		}
+		return call{arrayElementFunc, []sqlExpr{array, addInt(index, 1)}}, nil
 	}
-	return i.unsupportedExprError(args[1].Id, "index")
+	return nil, i.unsupportedExprError(args[1].Id, "index")
 }
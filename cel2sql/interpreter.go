@@ -3,27 +3,62 @@ package cel2sql
 import (
 	"errors"
 	"fmt"
-	"strings"
 	"time"
 
 	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common/operators"
 	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
 )
 
-const (
-	space = " "
-)
-
 // ErrUnsupportedExpression is a sentinel error returned when the CEL expression
 // cannot be converted to a set of compatible SQL filters.
 var ErrUnsupportedExpression = errors.New("unsupported CEL")
 
 // interpreter is a statefull converter of CEL expressions to equivalent SQL
-// filters in the Postgres dialect.
+// filters in the configured dialect. The CEL AST is first translated into a SQL
+// expression tree, which is then rendered by the renderer.
 type interpreter struct {
 	checkedExpr *exprpb.CheckedExpr
 
-	query strings.Builder
+	dialect Dialect
+
+	// parameterize indicates whether literal values must be replaced with
+	// placeholders and collected into vars instead of being inlined.
+	parameterize bool
+	placeholder  PlaceholderStyle
+	vars         []any
+
+	// now is the instant the now() function refers to. The current time of
+	// the database is used if it's zero.
+	now time.Time
+
+	// callsNow indicates whether the SQL filter refers to the instant of the
+	// now() function.
+	callsNow bool
+
+	// jsonContainment indicates whether the equality of JSON values and
+	// constants is translated into JSON containment checks.
+	jsonContainment bool
+
+	// functions holds the custom functions by name.
+	functions map[string]*Function
+
+	// mapping tells which columns hold the fields of the CEL expression.
+	mapping Mapping
+
+	// limits bounds the cost of the expression, which is measured as it's
+	// interpreted.
+	limits Limits
+	cost   Cost
+
+	// columns holds the sorted names of the columns the SQL filter refers
+	// to.
+	columns []string
+
+	// iterVars holds the iteration variables of the comprehensions being
+	// interpreted.
+	iterVars []iterVar
 }
 
 // newInterpreter takes an abstract syntax tree and returns an Interpreter object capable
@@ -34,20 +69,40 @@ func newInterpreter(ast *cel.Ast) (*interpreter, error) {
 		return nil, err
 	}
 	return &interpreter{
-		checkedExpr: checkedExpr,
+		checkedExpr:     checkedExpr,
+		dialect:         PostgresDialect{},
+		jsonContainment: true,
+		mapping:         DefaultMapping(),
 	}, nil
 }
 
 // interpret attempts to convert the CEL AST into a set of valid SQL filters. It
 // returns an error if the conversion cannot be done.
 func (i *interpreter) interpret() (string, error) {
-	if err := i.interpretExpr(i.checkedExpr.Expr); err != nil {
+	expr, err := i.interpretExpr(i.checkedExpr.Expr)
+	if err != nil {
 		return "", err
 	}
-	return strings.TrimSpace(i.query.String()), nil
+
+	expr = optimize(expr)
+	i.cost.measureFunctions(i.checkedExpr.Expr)
+	i.cost.measureSQL(expr)
+	if err := i.limits.check(i.cost); err != nil {
+		return "", err
+	}
+	i.columns = referencedColumns(expr)
+
+	renderer := &renderer{
+		dialect:      i.dialect,
+		parameterize: i.parameterize,
+		placeholder:  i.placeholder,
+	}
+	query := renderer.renderSQL(expr)
+	i.vars = renderer.vars
+	return query, nil
 }
 
-func (i *interpreter) interpretExpr(expr *exprpb.Expr) error {
+func (i *interpreter) interpretExpr(expr *exprpb.Expr) (sqlExpr, error) {
 	id := expr.Id
 	switch node := expr.ExprKind.(type) {
 	case *exprpb.Expr_ConstExpr:
@@ -65,15 +120,23 @@ func (i *interpreter) interpretExpr(expr *exprpb.Expr) error {
 	case *exprpb.Expr_ListExpr:
 		return i.interpretListExpr(id, node)
 
+	case *exprpb.Expr_ComprehensionExpr:
+		return i.interpretComprehensionExpr(id, node)
+
 	default:
-		return i.unsupportedExprError(id, "")
+		return nil, i.unsupportedExprError(id, "")
 	}
 }
 
 // unsupportedExprError attempts to return a descriptive error on why the
 // provided CEL expression could not be converted.
 func (i *interpreter) unsupportedExprError(id int64, name string) error {
-	sourceInfo := i.checkedExpr.SourceInfo
+	return unsupportedExprErrorAt(i.checkedExpr.SourceInfo, id, name)
+}
+
+// unsupportedExprErrorAt returns an ErrUnsupportedExpression error pointing at
+// the position of the expression with the provided ID in the source.
+func unsupportedExprErrorAt(sourceInfo *exprpb.SourceInfo, id int64, name string) error {
 	column := sourceInfo.Positions[id]
 	var line int32
 	for i, offset := range sourceInfo.LineOffsets {
@@ -90,104 +153,88 @@ func (i *interpreter) unsupportedExprError(id int64, name string) error {
 	return fmt.Errorf("%w %sstatement at line %d, column %d", ErrUnsupportedExpression, name, line, column)
 }
 
-func (i *interpreter) interpretConstExpr(id int64, expr *exprpb.Constant) error {
+func (i *interpreter) interpretConstExpr(id int64, expr *exprpb.Constant) (sqlExpr, error) {
 	switch expr.ConstantKind.(type) {
 
 	case *exprpb.Constant_NullValue:
-		i.query.WriteString("NULL")
+		return literal{nil}, nil
 
 	case *exprpb.Constant_BoolValue:
-		if expr.GetBoolValue() {
-			i.query.WriteString("TRUE")
-		} else {
-			i.query.WriteString("FALSE")
-		}
+		return literal{expr.GetBoolValue()}, nil
 
 	case *exprpb.Constant_Int64Value:
-		fmt.Fprintf(&i.query, "%d", expr.GetInt64Value())
+		return literal{expr.GetInt64Value()}, nil
 
 	case *exprpb.Constant_Uint64Value:
-		fmt.Fprintf(&i.query, "%d", expr.GetInt64Value())
+		return literal{expr.GetUint64Value()}, nil
 
 	case *exprpb.Constant_DoubleValue:
-		fmt.Fprintf(&i.query, "%f", expr.GetDoubleValue())
+		return literal{expr.GetDoubleValue()}, nil
 
 	case *exprpb.Constant_StringValue:
-		fmt.Fprintf(&i.query, "'%s'", expr.GetStringValue())
+		return literal{expr.GetStringValue()}, nil
 
 	case *exprpb.Constant_DurationValue:
-		fmt.Fprintf(&i.query, "'%d SECONDS'", expr.GetDurationValue().Seconds)
+		return interval{expr.GetDurationValue().AsDuration()}, nil
 
 	case *exprpb.Constant_TimestampValue:
-		timestamp := expr.GetTimestampValue()
-		fmt.Fprintf(&i.query, "TIMESTAMP WITH TIME ZONE '%s'", timestamp.AsTime().Format(time.RFC3339))
+		timestamp := expr.GetTimestampValue().AsTime().Format(time.RFC3339Nano)
+		return cast{literal{timestamp}, TimestampType}, nil
 
 	default:
-		return i.unsupportedExprError(id, "constant")
+		return nil, i.unsupportedExprError(id, "constant")
 	}
-	return nil
 }
 
-func (i *interpreter) interpretIdentExpr(id int64, expr *exprpb.Expr_IdentExpr) error {
+func (i *interpreter) interpretIdentExpr(id int64, expr *exprpb.Expr_IdentExpr) (sqlExpr, error) {
 	if reference, found := i.checkedExpr.ReferenceMap[id]; found && reference.GetValue() != nil {
 		return i.interpretConstExpr(id, reference.GetValue())
 	}
 	name := expr.IdentExpr.GetName()
-	if name == "data_type" {
-		// This field maps to the records.type column.
-		name = "type"
+	if alias, ok := i.iterVarAlias(name); ok {
+		// Iteration variables are bound to JSON elements, so we extract them
+		// as text in order to compare them to other values.
+		return paren{jsonExtract{document: column{alias}, asText: true}}, nil
 	}
-	i.query.WriteString(name)
-	return nil
+	// Identifiers are named after their columns unless mapped otherwise.
+	if mapped, ok := i.mappedColumnOf(&exprpb.Expr{Id: id, ExprKind: expr}); ok {
+		name = mapped
+	}
+	return column{name}, nil
 }
 
-func (i *interpreter) interpretSelectExpr(id int64, expr *exprpb.Expr_SelectExpr, additionalExprs ...*exprpb.Expr) error {
-	fields := []string{expr.SelectExpr.GetField()}
-
-	target := expr.SelectExpr.GetOperand()
-	for target != nil {
-		switch target.ExprKind.(type) {
-		case *exprpb.Expr_SelectExpr:
-			fields = append(fields, target.GetSelectExpr().GetField())
-
-		case *exprpb.Expr_IdentExpr:
-			fields = append(fields, target.GetIdentExpr().GetName())
-
-		default:
-			return ErrUnsupportedExpression
-		}
-		target = target.GetSelectExpr().GetOperand()
+func (i *interpreter) interpretSelectExpr(id int64, expr *exprpb.Expr_SelectExpr) (sqlExpr, error) {
+	if expr.SelectExpr.GetTestOnly() {
+		return i.interpretHasMacro(id, expr)
 	}
 
-	reversedFields := make([]string, len(fields))
-	for j, k := 0, len(fields)-1; j < len(reversedFields); j, k = j+1, k-1 {
-		reversedFields[j] = fields[k]
+	selectExpr := &exprpb.Expr{Id: id, ExprKind: expr}
+	if name, ok := i.mappedColumnOf(selectExpr); ok {
+		return column{name}, nil
 	}
 
-	for _, node := range additionalExprs {
-		switch node.ExprKind.(type) {
-		case *exprpb.Expr_ConstExpr:
-			reversedFields = append(reversedFields, node.GetConstExpr().GetStringValue())
-
-		default:
-			return ErrUnsupportedExpression
+	operand := expr.SelectExpr.GetOperand()
+	if i.isDyn(operand) || i.isInJSONColumn(operand) {
+		root, path, err := i.jsonPathOf(selectExpr)
+		if err != nil {
+			return nil, err
 		}
+		accessors := translateToJSONAccessors(root, path)
+		if i.isDyn(selectExpr) {
+			return accessors, nil
+		}
+		// Fields of messages stored in JSON columns are cast to their types.
+		return i.coerceToTypeOf(accessors, selectExpr)
 	}
 
-	if i.isDyn(expr.SelectExpr.GetOperand()) {
-		i.translateToJSONAccessors(reversedFields)
-		return nil
-	}
-
-	if i.isRecordSummary(expr.SelectExpr.GetOperand()) {
-		i.translateIntoRecordSummaryColum(reversedFields)
-		return nil
+	root, _, err := i.jsonPathOf(operand)
+	if err != nil {
+		return nil, err
 	}
-
-	return fmt.Errorf("%w. %s: not recognized field.", i.unsupportedExprError(id, "select"), reversedFields[0])
+	return nil, fmt.Errorf("%w. %s: not recognized field.", i.unsupportedExprError(id, "select"), root)
 }
 
-func (i *interpreter) interpretCallExpr(id int64, expr *exprpb.Expr_CallExpr) error {
+func (i *interpreter) interpretCallExpr(id int64, expr *exprpb.Expr_CallExpr) (sqlExpr, error) {
 	function := expr.CallExpr.GetFunction()
 	if isUnaryOperator(function) {
 		return i.interpretUnaryCallExpr(expr)
@@ -200,25 +247,43 @@ func (i *interpreter) interpretCallExpr(id int64, expr *exprpb.Expr_CallExpr) er
 		return i.interpretIndexExpr(id, expr)
 	}
 
+	if isConditionalOperator(function) {
+		return i.interpretConditionalExpr(expr)
+	}
+
 	return i.interpretFunctionCallExpr(id, expr)
 }
 
-func (i *interpreter) interpretUnaryCallExpr(expr *exprpb.Expr_CallExpr) error {
-	sqlOperator := unaryOperators[expr.CallExpr.GetFunction()]
-	i.query.WriteString(sqlOperator)
-	i.query.WriteString(space)
-	if err := i.interpretExpr(expr.CallExpr.Args[0]); err != nil {
-		return err
+func (i *interpreter) interpretUnaryCallExpr(expr *exprpb.Expr_CallExpr) (sqlExpr, error) {
+	function := expr.CallExpr.GetFunction()
+	interpret := i.interpretExpr
+	if function == operators.LogicalNot {
+		interpret = i.interpretCondition
+	}
+	operand, err := interpret(expr.CallExpr.Args[0])
+	if err != nil {
+		return nil, err
 	}
-	i.query.WriteString(space)
-	return nil
+	return unaryExpr{unaryOperators[function], operand}, nil
 }
 
-func (i *interpreter) interpretBinaryCallExpr(expr *exprpb.Expr_CallExpr) error {
+func (i *interpreter) interpretBinaryCallExpr(expr *exprpb.Expr_CallExpr) (sqlExpr, error) {
 	function := expr.CallExpr.GetFunction()
 	arg1 := expr.CallExpr.Args[0]
 	arg2 := expr.CallExpr.Args[1]
 
+	if function == operators.LogicalAnd || function == operators.LogicalOr {
+		return i.interpretLogicalExpr(function, arg1, arg2)
+	}
+
+	if isNullComparison(function, arg2) {
+		return i.interpretNullComparison(function, arg1)
+	}
+
+	if isNullComparison(function, arg1) {
+		return i.interpretNullComparison(function, arg2)
+	}
+
 	if i.mayBeTranslatedIntoJSONPathContainsExpression(arg1, function, arg2) {
 		return i.translateIntoJSONPathContainsExpression(arg1, arg2)
 	}
@@ -227,49 +292,120 @@ func (i *interpreter) interpretBinaryCallExpr(expr *exprpb.Expr_CallExpr) error
 		return i.translateIntoJSONPathContainsExpression(arg2, arg1)
 	}
 
-	sqlOperator := binaryOperators[function]
+	if function == operators.In && i.isDyn(arg2) {
+		return i.interpretInJSONArrayExpr(arg1, arg2)
+	}
 
-	if err := i.interpretExpr(arg1); err != nil {
-		return err
+	if function == operators.In && i.isArray(arg2) {
+		return i.interpretInArrayExpr(arg1, arg2)
 	}
 
-	// Implicit coercion
-	if i.isDyn(arg1) {
-		if err := i.coerceToTypeOf(arg2); err != nil {
-			return err
-		}
+	if function == operators.Add && i.isDuration(arg1) {
+		// Addition is commutative.
+		arg1, arg2 = arg2, arg1
+	}
+	if (function == operators.Add || function == operators.Subtract) && i.isDuration(arg2) {
+		return i.interpretTimestampArithmeticExpr(function, arg1, arg2)
+	}
+	if function == operators.Subtract && (i.isTimestamp(arg1) || i.isTimestamp(arg2)) {
+		return i.interpretTimestampDiffExpr(arg1, arg2)
 	}
 
-	i.query.WriteString(space)
-	i.query.WriteString(sqlOperator)
-	i.query.WriteString(space)
+	left, err := i.interpretCoercedExpr(arg1, arg2)
+	if err != nil {
+		return nil, err
+	}
+	right, err := i.interpretCoercedExpr(arg2, arg1)
+	if err != nil {
+		return nil, err
+	}
+	return binaryExpr{binaryOperators[function], left, right}, nil
+}
 
-	if err := i.interpretExpr(arg2); err != nil {
-		return err
+// interpretLogicalExpr translates the && and || operators.
+func (i *interpreter) interpretLogicalExpr(function string, arg1, arg2 *exprpb.Expr) (sqlExpr, error) {
+	left, err := i.interpretCondition(arg1)
+	if err != nil {
+		return nil, err
 	}
+	right, err := i.interpretCondition(arg2)
+	if err != nil {
+		return nil, err
+	}
+	return binaryExpr{binaryOperators[function], left, right}, nil
+}
 
-	// Implicit coercion
-	if i.isDyn(arg2) {
-		if err := i.coerceToTypeOf(arg1); err != nil {
-			return err
-		}
+// interpretCondition interprets the provided operand of a logical operator or
+// condition of a conditional operator. Dyn values are cast to booleans, since
+// the text of JSON values can't be used as a condition as is.
+func (i *interpreter) interpretCondition(expr *exprpb.Expr) (sqlExpr, error) {
+	return i.interpretCoercedArg(expr, decls.Bool)
+}
+
+// interpretInJSONArrayExpr translates the in operator applied to a dyn JSON
+// array, by looking the element up among the elements of the array.
+func (i *interpreter) interpretInJSONArrayExpr(elem, array *exprpb.Expr) (sqlExpr, error) {
+	value, err := i.interpretExpr(elem)
+	if err != nil {
+		return nil, err
+	}
+	elements, err := i.interpretJSONExpr(array)
+	if err != nil {
+		return nil, err
 	}
-	i.query.WriteString(space)
 
-	return nil
+	const alias = "element"
+	return binaryExpr{"IN", value, subquery{
+		selection: jsonExtract{document: column{alias}, asText: true},
+		array:     elements,
+		alias:     alias,
+	}}, nil
 }
 
-func (i *interpreter) interpretListExpr(id int64, expr *exprpb.Expr_ListExpr) error {
-	elements := expr.ListExpr.GetElements()
-	i.query.WriteString("(")
-	for index, elem := range elements {
-		if err := i.interpretExpr(elem); err != nil {
-			return err
-		}
-		if index < len(elements)-1 {
-			i.query.WriteString(", ")
+// interpretInArrayExpr translates the in operator applied to a list that is
+// translated into a SQL array.
+func (i *interpreter) interpretInArrayExpr(elem, array *exprpb.Expr) (sqlExpr, error) {
+	value, err := i.interpretExpr(elem)
+	if err != nil {
+		return nil, err
+	}
+	elements, err := i.interpretExpr(array)
+	if err != nil {
+		return nil, err
+	}
+	return call{arrayContainsFunc, []sqlExpr{elements, value}}, nil
+}
+
+// interpretConditionalExpr translates the CEL ternary operator into a SQL CASE
+// expression. Since both branches of a CASE expression must yield the same SQL
+// type, a dyn branch is implicitly coerced to the type of the other one.
+func (i *interpreter) interpretConditionalExpr(expr *exprpb.Expr_CallExpr) (sqlExpr, error) {
+	args := expr.CallExpr.GetArgs()
+	condition, consequent, alternative := args[0], args[1], args[2]
+
+	when, err := i.interpretCondition(condition)
+	if err != nil {
+		return nil, err
+	}
+	then, err := i.interpretCoercedExpr(consequent, alternative)
+	if err != nil {
+		return nil, err
+	}
+	otherwise, err := i.interpretCoercedExpr(alternative, consequent)
+	if err != nil {
+		return nil, err
+	}
+	return caseExpr{when, then, otherwise}, nil
+}
+
+func (i *interpreter) interpretListExpr(id int64, expr *exprpb.Expr_ListExpr) (sqlExpr, error) {
+	elements := make([]sqlExpr, 0, len(expr.ListExpr.GetElements()))
+	for _, elem := range expr.ListExpr.GetElements() {
+		element, err := i.interpretExpr(elem)
+		if err != nil {
+			return nil, err
 		}
+		elements = append(elements, element)
 	}
-	i.query.WriteString(")")
-	return nil
+	return list{elements}, nil
 }
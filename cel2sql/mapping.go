@@ -0,0 +1,160 @@
+package cel2sql
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm/schema"
+)
+
+// Mapping tells where the fields of CEL expressions are stored in the
+// database. Its keys are the paths of the fields, which are identifiers
+// optionally followed by a chain of field selections, such as data_type or
+// summary.annotations. Identifiers that aren't mapped are stored in the column
+// with the same name.
+type Mapping map[string]Field
+
+// Field describes how a CEL field is stored in the database. Exactly one of
+// its members must be set.
+type Field struct {
+	// Column is the name of the column that holds the field.
+	Column string `yaml:"column,omitempty"`
+
+	// JSON is the name of the JSON column that holds the field. The fields
+	// selected from messages stored in it are extracted from the JSON
+	// document, just like the keys of dyn values.
+	JSON string `yaml:"json,omitempty"`
+
+	// Prefix is the prefix of the columns that hold the fields of an embedded
+	// struct. Each field is stored in a column named after the prefix followed
+	// by the snake case name of the field, as gorm names the columns of
+	// embedded structs.
+	Prefix string `yaml:"prefix,omitempty"`
+}
+
+// DefaultMapping returns the mapping of the Tekton Results tables, in which
+// the data_type field of records is stored in the type column and the fields
+// of the summary of results are embedded with the recordsummary_ prefix.
+func DefaultMapping() Mapping {
+	return Mapping{
+		"data_type": {Column: "type"},
+		"summary":   {Prefix: "recordsummary_"},
+	}
+}
+
+// ParseMapping parses a mapping written in YAML, in which each path is mapped
+// to an object with one of the column, json or prefix keys:
+//
+//	data_type:
+//	  column: type
+//	summary:
+//	  prefix: recordsummary_
+func ParseMapping(data []byte) (Mapping, error) {
+	mapping := Mapping{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&mapping); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("error parsing mapping: %w", err)
+	}
+	if err := mapping.Validate(); err != nil {
+		return nil, err
+	}
+	return mapping, nil
+}
+
+// LoadMapping reads and parses the YAML mapping in the provided file. See
+// ParseMapping.
+func LoadMapping(path string) (Mapping, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading mapping: %w", err)
+	}
+	return ParseMapping(data)
+}
+
+// Validate returns an error if any of the fields of the mapping doesn't set
+// exactly one of its members.
+func (m Mapping) Validate() error {
+	for path, field := range m {
+		set := 0
+		for _, member := range []string{field.Column, field.JSON, field.Prefix} {
+			if member != "" {
+				set++
+			}
+		}
+		if set != 1 {
+			return fmt.Errorf("invalid mapping of %s: exactly one of column, json or prefix must be set", path)
+		}
+	}
+	return nil
+}
+
+// fieldPathOf returns the path of the provided identifier or chain of field
+// selections, such as summary.annotations. Iteration variables don't have a
+// path.
+func (i *interpreter) fieldPathOf(expr *exprpb.Expr) (string, bool) {
+	switch node := expr.ExprKind.(type) {
+	case *exprpb.Expr_IdentExpr:
+		name := node.IdentExpr.GetName()
+		return name, !i.isIterVar(name)
+
+	case *exprpb.Expr_SelectExpr:
+		if node.SelectExpr.GetTestOnly() {
+			return "", false
+		}
+		path, ok := i.fieldPathOf(node.SelectExpr.GetOperand())
+		return path + "." + node.SelectExpr.GetField(), ok
+	}
+	return "", false
+}
+
+// mappedColumnOf returns the column that holds the provided identifier or field
+// selection according to the mapping, if any.
+func (i *interpreter) mappedColumnOf(expr *exprpb.Expr) (string, bool) {
+	path, ok := i.fieldPathOf(expr)
+	if !ok {
+		return "", false
+	}
+	if field, found := i.mapping[path]; found {
+		if field.Column != "" {
+			return field.Column, true
+		}
+		if field.JSON != "" {
+			return field.JSON, true
+		}
+		return "", false
+	}
+
+	selectExpr := expr.GetSelectExpr()
+	if selectExpr == nil {
+		return "", false
+	}
+	parent, _ := i.fieldPathOf(selectExpr.GetOperand())
+	if prefix := i.mapping[parent].Prefix; prefix != "" {
+		namer := &schema.NamingStrategy{}
+		return prefix + namer.ColumnName("", selectExpr.GetField()), true
+	}
+	return "", false
+}
+
+// isInJSONColumn returns true if the provided identifier or field selection is
+// stored in a JSON column according to the mapping, either as a whole or
+// within a field that is.
+func (i *interpreter) isInJSONColumn(expr *exprpb.Expr) bool {
+	path, ok := i.fieldPathOf(expr)
+	if !ok {
+		return false
+	}
+	if i.mapping[path].JSON != "" {
+		return true
+	}
+	if selectExpr := expr.GetSelectExpr(); selectExpr != nil {
+		return i.isInJSONColumn(selectExpr.GetOperand())
+	}
+	return false
+}
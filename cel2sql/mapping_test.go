@@ -0,0 +1,60 @@
+package cel2sql
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseMapping(t *testing.T) {
+	got, err := ParseMapping([]byte(`
+data_type:
+  column: type
+data:
+  json: data
+summary:
+  prefix: recordsummary_
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Mapping{
+		"data_type": {Column: "type"},
+		"data":      {JSON: "data"},
+		"summary":   {Prefix: "recordsummary_"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseMappingErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+	}{{
+		name: "several members",
+		in:   "summary: {column: summary, prefix: recordsummary_}",
+	},
+		{
+			name: "no members",
+			in:   "summary: {}",
+		},
+		{
+			name: "unknown member",
+			in:   "summary: {table: summaries}",
+		},
+		{
+			name: "malformed YAML",
+			in:   "summary: [",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := ParseMapping([]byte(test.in)); err == nil {
+				t.Error("Want error, but got nil")
+			}
+		})
+	}
+}
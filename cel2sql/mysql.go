@@ -0,0 +1,214 @@
+package cel2sql
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MySQLDialect translates CEL expressions into MySQL 8 SQL. JSON values are
+// expected to be stored in JSON columns. Comparisons of JSON values with
+// constants extract the values rather than checking the containment of JSON
+// documents, since JSON_CONTAINS matches scalars with the elements of arrays
+// found at their paths.
+type MySQLDialect struct{}
+
+// QuoteString implements the StringQuoter interface. Backslashes are escaped,
+// since MySQL treats them as escape characters in string literals.
+func (MySQLDialect) QuoteString(s string) string {
+	return quoteString(strings.ReplaceAll(s, `\`, `\\`))
+}
+
+// JSONExtract implements the Dialect interface.
+func (MySQLDialect) JSONExtract(document string, path []JSONPathElement, asText bool, value ValueFunc) string {
+	expr := document
+	if len(path) > 0 {
+		expr = fmt.Sprintf("JSON_EXTRACT(%s, %s)", document, value(jsonPath(path)))
+	}
+	if asText {
+		return fmt.Sprintf("JSON_UNQUOTE(%s)", expr)
+	}
+	return expr
+}
+
+// JSONHasPath implements the Dialect interface.
+func (MySQLDialect) JSONHasPath(document string, path []JSONPathElement, value ValueFunc) string {
+	return fmt.Sprintf("JSON_CONTAINS_PATH(%s, 'one', %s)", document, value(jsonPath(path)))
+}
+
+// JSONIsNull implements the Dialect interface.
+func (d MySQLDialect) JSONIsNull(document string, path []JSONPathElement, negated bool, value ValueFunc) string {
+	return fmt.Sprintf("JSON_TYPE(%s) %s 'NULL'", d.JSONExtract(document, path, false, value), equalityOperator(negated))
+}
+
+// JSONArrayElements implements the Dialect interface.
+func (MySQLDialect) JSONArrayElements(array, alias string) string {
+	return fmt.Sprintf("JSON_TABLE(%s, '$[*]' COLUMNS (%s JSON PATH '$')) AS %[2]s", array, alias)
+}
+
+// JSONSize implements the Dialect interface.
+func (MySQLDialect) JSONSize(document string) string {
+	return fmt.Sprintf("CASE JSON_TYPE(%[1]s) WHEN 'STRING' THEN CHAR_LENGTH(JSON_UNQUOTE(%[1]s)) ELSE JSON_LENGTH(%[1]s) END", document)
+}
+
+// JSONObjectSize implements the Dialect interface.
+func (MySQLDialect) JSONObjectSize(document string) string {
+	return fmt.Sprintf("JSON_LENGTH(%s)", document)
+}
+
+// StringLength implements the Dialect interface.
+func (MySQLDialect) StringLength(str string) string {
+	return fmt.Sprintf("CHAR_LENGTH(%s)", str)
+}
+
+// Contains implements the Dialect interface.
+func (d MySQLDialect) Contains(str, substr string) string {
+	return d.Position(str, substr) + " <> 0"
+}
+
+// StartsWith implements the Dialect interface.
+func (MySQLDialect) StartsWith(str, prefix, pattern string) string {
+	return fmt.Sprintf("%s LIKE CONCAT(%s, '%%') ESCAPE '!'", str, pattern)
+}
+
+// EndsWith implements the Dialect interface.
+func (MySQLDialect) EndsWith(str, suffix, pattern string) string {
+	return fmt.Sprintf("%s LIKE CONCAT('%%', %s) ESCAPE '!'", str, pattern)
+}
+
+// Matches implements the Dialect interface.
+func (MySQLDialect) Matches(str, pattern string) string {
+	return fmt.Sprintf("REGEXP_LIKE(%s, %s)", str, pattern)
+}
+
+// TranslateRegexp implements the Dialect interface.
+func (MySQLDialect) TranslateRegexp(pattern string) (string, error) {
+	return translateRegexp(pattern, icuRegexp)
+}
+
+// Trim implements the Dialect interface. TRIM only removes spaces.
+func (MySQLDialect) Trim(str string) string {
+	return fmt.Sprintf("REGEXP_REPLACE(%s, '^[[:space:]]+|[[:space:]]+$', '')", str)
+}
+
+// Replace implements the Dialect interface.
+func (MySQLDialect) Replace(str, old, new string) string {
+	return fmt.Sprintf("REPLACE(%s, %s, %s)", str, old, new)
+}
+
+// Substring implements the Dialect interface.
+func (MySQLDialect) Substring(str, start, length string) string {
+	if length == "" {
+		return fmt.Sprintf("SUBSTRING(%s, %s)", str, start)
+	}
+	return fmt.Sprintf("SUBSTRING(%s, %s, %s)", str, start, length)
+}
+
+// Position implements the Dialect interface. LOCATE follows the collation of
+// its arguments, which is usually case-insensitive, so the substring is
+// compared with the binary collation. Unlike a cast to BINARY, it keeps
+// counting characters rather than bytes.
+func (MySQLDialect) Position(str, substr string) string {
+	return fmt.Sprintf("LOCATE(%s COLLATE utf8mb4_bin, %s)", substr, str)
+}
+
+// Truncate implements the Dialect interface.
+func (MySQLDialect) Truncate(number string) string {
+	return fmt.Sprintf("TRUNCATE(%s, 0)", number)
+}
+
+// Extract implements the Dialect interface.
+func (MySQLDialect) Extract(part DatePart, timestamp string) string {
+	switch part {
+	case DayOfWeek:
+		// DAYOFWEEK returns 1 for Sunday.
+		return fmt.Sprintf("(DAYOFWEEK(%s) - 1)", timestamp)
+
+	case DayOfYear:
+		return fmt.Sprintf("DAYOFYEAR(%s)", timestamp)
+
+	case Millisecond:
+		return fmt.Sprintf("FLOOR(EXTRACT(MICROSECOND FROM %s) / 1000)", timestamp)
+	}
+	return fmt.Sprintf("EXTRACT(%s FROM %s)", part, timestamp)
+}
+
+// AtTimeZone implements the Dialect interface. Named time zones require the
+// time zone tables to be loaded into the database.
+func (MySQLDialect) AtTimeZone(timestamp, zone string, value ValueFunc) string {
+	return fmt.Sprintf("CONVERT_TZ(%s, '+00:00', %s)", timestamp, value(zone))
+}
+
+// Now implements the Dialect interface. Since timestamps are converted into
+// DATETIME values in UTC, the current time is taken in UTC as well.
+func (MySQLDialect) Now() string {
+	return "UTC_TIMESTAMP(6)"
+}
+
+// AddDuration implements the Dialect interface.
+func (MySQLDialect) AddDuration(timestamp string, duration time.Duration, value ValueFunc) string {
+	operator := "+"
+	if duration < 0 {
+		operator, duration = "-", -duration
+	}
+	if duration%time.Second != 0 {
+		return fmt.Sprintf("%s %s INTERVAL %s MICROSECOND", timestamp, operator, value(duration.Microseconds()))
+	}
+	return fmt.Sprintf("%s %s INTERVAL %s SECOND", timestamp, operator, value(int64(duration/time.Second)))
+}
+
+// Interval implements the Dialect interface. Durations are represented as
+// numbers of seconds, since MySQL doesn't have an interval type.
+func (MySQLDialect) Interval(duration time.Duration, value ValueFunc) string {
+	return value(seconds(duration))
+}
+
+// TimestampDiff implements the Dialect interface. Subtracting DATETIME values
+// would subtract their YYYYMMDDhhmmss numeric forms instead.
+func (MySQLDialect) TimestampDiff(end, start string) string {
+	return fmt.Sprintf("TIMESTAMPDIFF(MICROSECOND, %s, %s) / 1000000", start, end)
+}
+
+// Cast implements the Dialect interface. Booleans are extracted from JSON
+// documents as the true and false strings, which are compared instead of
+// cast. Durations are converted into numbers of seconds by adding up their
+// hours, minutes, seconds and milliseconds; other units and negative
+// durations aren't supported.
+func (MySQLDialect) Cast(expr string, to SQLType) string {
+	switch to {
+	case TimestampType:
+		return fmt.Sprintf("CAST(%s AS DATETIME)", expr)
+
+	case IntType:
+		return fmt.Sprintf("CAST(%s AS SIGNED)", expr)
+
+	case DoubleType:
+		return fmt.Sprintf("CAST(%s AS DOUBLE)", expr)
+
+	case BooleanType:
+		return fmt.Sprintf("(%s = 'true')", expr)
+
+	case DurationType:
+		// The patterns match the amounts followed by their units, which are
+		// then stripped along with what follows them. They avoid lookaheads
+		// since gorm would take their question marks for placeholders.
+		units := []struct {
+			pattern string
+			factor  string
+		}{
+			{`[0-9.]+h`, "3600"},
+			{`[0-9.]+m([^s]|$)`, "60"},
+			{`[0-9.]+s`, "1"},
+			{`[0-9.]+ms`, "0.001"},
+		}
+		terms := make([]string, 0, len(units))
+		for _, unit := range units {
+			terms = append(terms, fmt.Sprintf("COALESCE(REGEXP_REPLACE(REGEXP_SUBSTR(%s, '%s'), '[a-z].*', ''), 0) * %s", expr, unit.pattern, unit.factor))
+		}
+		return "(" + strings.Join(terms, " + ") + ")"
+
+	case StringType:
+		return fmt.Sprintf("CAST(%s AS CHAR)", expr)
+	}
+	return expr
+}
@@ -0,0 +1,35 @@
+package cel2sql
+
+import (
+	"github.com/google/cel-go/common/operators"
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// isNullComparison returns true if the provided operator compares arg2, which
+// must be the null constant, for equality or inequality.
+func isNullComparison(function string, arg2 *exprpb.Expr) bool {
+	if function != operators.Equals && function != operators.NotEquals {
+		return false
+	}
+	_, isNull := arg2.GetConstExpr().GetConstantKind().(*exprpb.Constant_NullValue)
+	return isNull
+}
+
+// interpretNullComparison translates the comparison of the provided
+// expression and null, as documented in Convert.
+func (i *interpreter) interpretNullComparison(function string, expr *exprpb.Expr) (sqlExpr, error) {
+	if i.isDyn(expr) {
+		if root, path, err := i.jsonPathOf(expr); err == nil {
+			return jsonIsNull{document: column{root}, path: path, negated: function == operators.NotEquals}, nil
+		}
+	}
+
+	operand, err := i.interpretExpr(expr)
+	if err != nil {
+		return nil, err
+	}
+	if function == operators.NotEquals {
+		return postfixExpr{operand, "IS NOT NULL"}, nil
+	}
+	return postfixExpr{operand, "IS NULL"}, nil
+}
@@ -6,13 +6,13 @@ import (
 
 var (
 	unaryOperators = map[string]string{
-		operators.Negate: "NOT",
+		operators.Negate:     "-",
+		operators.LogicalNot: "NOT",
 	}
 
 	binaryOperators = map[string]string{
 		operators.LogicalAnd:    "AND",
 		operators.LogicalOr:     "OR",
-		operators.LogicalNot:    "NOT",
 		operators.Equals:        "=",
 		operators.NotEquals:     "<>",
 		operators.Less:          "<",
@@ -41,3 +41,9 @@ func isBinaryOperator(symbol string) bool {
 	_, found := binaryOperators[symbol]
 	return found
 }
+
+// isConditionalOperator returns true if the symbol in question is the CEL
+// ternary operator.
+func isConditionalOperator(symbol string) bool {
+	return symbol == operators.Conditional
+}
@@ -0,0 +1,169 @@
+package cel2sql
+
+import (
+	"reflect"
+)
+
+// optimize simplifies the SQL expression tree before it's rendered. Within
+// each chain of conjunctions, JSON containment checks on the same document are
+// merged into a single check and repeated predicates are removed, so that the
+// database looks its indexes up once.
+func optimize(expr sqlExpr) sqlExpr {
+	if node, ok := expr.(binaryExpr); ok && node.op == "AND" {
+		return optimizeConjunction(node)
+	}
+	return mapChildren(expr, optimize)
+}
+
+// optimizeConjunction merges the JSON containment checks and removes the
+// duplicates among the operands of the provided chain of conjunctions.
+func optimizeConjunction(expr binaryExpr) sqlExpr {
+	var operands []sqlExpr
+	for _, operand := range conjuncts(expr) {
+		operand = optimize(operand)
+		if merged, ok := mergeIntoConjuncts(operands, operand); ok {
+			operands = merged
+			continue
+		}
+		operands = append(operands, operand)
+	}
+
+	result := operands[0]
+	for _, operand := range operands[1:] {
+		result = binaryExpr{"AND", result, operand}
+	}
+	return result
+}
+
+// conjuncts returns the operands of the provided chain of conjunctions in the
+// order they're rendered.
+func conjuncts(expr sqlExpr) []sqlExpr {
+	if node, ok := expr.(binaryExpr); ok && node.op == "AND" {
+		return append(conjuncts(node.left), conjuncts(node.right)...)
+	}
+	return []sqlExpr{expr}
+}
+
+// mergeIntoConjuncts returns the provided conjuncts with the operand merged
+// into them, which is possible if it's a repeated predicate or a JSON
+// containment check on the same document as one of the conjuncts. It returns
+// false if the operand can't be merged.
+func mergeIntoConjuncts(conjuncts []sqlExpr, operand sqlExpr) ([]sqlExpr, bool) {
+	for index, conjunct := range conjuncts {
+		if reflect.DeepEqual(conjunct, operand) {
+			return conjuncts, true
+		}
+
+		containment, ok := conjunct.(jsonContains)
+		other, otherOK := operand.(jsonContains)
+		if !ok || !otherOK || !reflect.DeepEqual(containment.document, other.document) {
+			continue
+		}
+		if candidate, ok := mergeCandidates(containment.candidate, other.candidate); ok {
+			conjuncts[index] = jsonContains{containment.document, candidate}
+			return conjuncts, true
+		}
+	}
+	return nil, false
+}
+
+// mergeCandidates returns a JSON containment candidate that's equivalent to
+// checking both of the provided ones. Candidates that select different values
+// at the same path can't be merged.
+func mergeCandidates(a, b any) (any, bool) {
+	aObject, aOK := a.(map[string]any)
+	bObject, bOK := b.(map[string]any)
+	if !aOK || !bOK {
+		return a, !aOK && !bOK && a == b
+	}
+
+	merged := make(map[string]any, len(aObject)+len(bObject))
+	for key, value := range aObject {
+		merged[key] = value
+	}
+	for key, value := range bObject {
+		if existing, found := merged[key]; found {
+			mergedValue, ok := mergeCandidates(existing, value)
+			if !ok {
+				return nil, false
+			}
+			value = mergedValue
+		}
+		merged[key] = value
+	}
+	return merged, true
+}
+
+// mapChildren returns a copy of the provided node whose children are replaced
+// with the results of f.
+func mapChildren(expr sqlExpr, f func(sqlExpr) sqlExpr) sqlExpr {
+	switch node := expr.(type) {
+	case paren:
+		return paren{f(node.expr)}
+
+	case unaryExpr:
+		return unaryExpr{node.op, f(node.operand)}
+
+	case postfixExpr:
+		return postfixExpr{f(node.operand), node.op}
+
+	case binaryExpr:
+		return binaryExpr{node.op, f(node.left), f(node.right)}
+
+	case list:
+		return list{mapAll(node.elements, f)}
+
+	case caseExpr:
+		return caseExpr{f(node.when), f(node.then), f(node.otherwise)}
+
+	case cast:
+		return cast{f(node.expr), node.to}
+
+	case jsonExtract:
+		return jsonExtract{f(node.document), node.path, node.asText}
+
+	case jsonContains:
+		return jsonContains{f(node.document), node.candidate}
+
+	case jsonHasPath:
+		return jsonHasPath{f(node.document), node.path}
+
+	case jsonIsNull:
+		return jsonIsNull{f(node.document), node.path, node.negated}
+
+	case extract:
+		return extract{node.part, f(node.timestamp)}
+
+	case atTimeZone:
+		return atTimeZone{f(node.timestamp), node.zone}
+
+	case addDuration:
+		return addDuration{f(node.timestamp), node.duration}
+
+	case timestampDiff:
+		return timestampDiff{f(node.end), f(node.start)}
+
+	case call:
+		return call{node.function, mapAll(node.args, f)}
+
+	case customCall:
+		return customCall{node.function, mapAll(node.args, f)}
+
+	case subquery:
+		query := subquery{f(node.selection), f(node.array), node.alias, nil}
+		if node.where != nil {
+			query.where = f(node.where)
+		}
+		return query
+	}
+	// Leaves, such as columns and literals.
+	return expr
+}
+
+func mapAll(exprs []sqlExpr, f func(sqlExpr) sqlExpr) []sqlExpr {
+	mapped := make([]sqlExpr, 0, len(exprs))
+	for _, expr := range exprs {
+		mapped = append(mapped, f(expr))
+	}
+	return mapped
+}
@@ -0,0 +1,100 @@
+package cel2sql
+
+import (
+	"strconv"
+	"time"
+)
+
+// Option customizes the conversion of CEL expressions into SQL filters.
+type Option func(*interpreter)
+
+// PlaceholderStyle determines how bound values are referenced in parameterized
+// SQL filters.
+type PlaceholderStyle int
+
+const (
+	// QuestionMark yields `?` placeholders. This is the format understood by
+	// gorm, which rebinds them to the format of the underlying database.
+	QuestionMark PlaceholderStyle = iota
+
+	// DollarNumbered yields `$1`, `$2`, ... placeholders as expected by
+	// Postgres drivers.
+	DollarNumbered
+)
+
+// format returns the placeholder for the nth bound value (starting at 1).
+func (p PlaceholderStyle) format(n int) string {
+	if p == DollarNumbered {
+		return "$" + strconv.Itoa(n)
+	}
+	return "?"
+}
+
+// WithPlaceholderStyle sets the style of the placeholders written by
+// ConvertWithVars. Defaults to QuestionMark.
+func WithPlaceholderStyle(style PlaceholderStyle) Option {
+	return func(i *interpreter) {
+		i.placeholder = style
+	}
+}
+
+// WithDialect sets the SQL dialect of the generated filters. Defaults to
+// PostgresDialect.
+func WithDialect(dialect Dialect) Option {
+	return func(i *interpreter) {
+		i.dialect = dialect
+	}
+}
+
+// WithNow fixes the instant the now() function refers to, which otherwise
+// yields the current time of the database. It makes the generated SQL
+// deterministic and allows consistent filtering across separate queries, such
+// as the pages of a listing.
+func WithNow(now time.Time) Option {
+	return func(i *interpreter) {
+		i.now = now
+	}
+}
+
+// WithMapping sets the mapping of the fields of CEL expressions to the columns
+// that hold them. Defaults to DefaultMapping.
+func WithMapping(mapping Mapping) Option {
+	return func(i *interpreter) {
+		i.mapping = mapping
+	}
+}
+
+// WithFunctions adds custom functions to the conversion. See Function.
+func WithFunctions(functions ...Function) Option {
+	return func(i *interpreter) {
+		if i.functions == nil {
+			i.functions = make(map[string]*Function, len(functions))
+		}
+		for index := range functions {
+			i.functions[functions[index].Name] = &functions[index]
+		}
+	}
+}
+
+// WithLimits bounds the cost of the CEL expressions, which makes the conversion
+// fail with an ErrFilterTooComplex error when they exceed any of the limits. See
+// Cost. The cost isn't bounded by default.
+func WithLimits(limits Limits) Option {
+	return func(i *interpreter) {
+		i.limits = limits
+	}
+}
+
+// WithJSONContainment determines whether the equality of JSON values and
+// constants, such as data.metadata.labels["app"] == "foo", is translated into
+// a containment check on the whole JSON column, such as
+// data @> '{"metadata":{"labels":{"app":"foo"}}}' in Postgres. Containment
+// checks can be served by indexes over whole JSON documents, but the database
+// may prefer the extraction of the value when there's an index over the
+// expression instead. Enabled by default, for the dialects that implement
+// JSONContainmentDialect.
+func WithJSONContainment(enabled bool) Option {
+	return func(i *interpreter) {
+		i.jsonContainment = enabled
+	}
+}
@@ -0,0 +1,242 @@
+package cel2sql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The ASCII letters translated by the lowerAscii and upperAscii functions.
+const (
+	lowerASCIILetters = "abcdefghijklmnopqrstuvwxyz"
+	upperASCIILetters = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+)
+
+// PostgresDialect translates CEL expressions into Postgres SQL. JSON values
+// are expected to be stored in jsonb columns. This is the default dialect.
+type PostgresDialect struct{}
+
+// JSONExtract implements the Dialect interface.
+func (PostgresDialect) JSONExtract(document string, path []JSONPathElement, asText bool, value ValueFunc) string {
+	if len(path) == 0 {
+		if asText {
+			return document + "#>>'{}'"
+		}
+		return document
+	}
+
+	var expr strings.Builder
+	expr.WriteString(document)
+	for index, elem := range path {
+		if asText && index == len(path)-1 {
+			expr.WriteString("->>")
+		} else {
+			expr.WriteString("->")
+		}
+		if elem.IsIndex {
+			// Array indices are inlined, since Postgres can't tell whether a
+			// bound value is a key or an index.
+			expr.WriteString(strconv.FormatInt(elem.Index, 10))
+		} else {
+			expr.WriteString(value(elem.Key))
+		}
+	}
+	return expr.String()
+}
+
+// JSONContains implements the JSONContainmentDialect interface. Arrays only
+// contain scalars at the top level of the document, which candidates never
+// are.
+func (PostgresDialect) JSONContains(document, candidate string) string {
+	return fmt.Sprintf("%s @> %s::jsonb", document, candidate)
+}
+
+// JSONHasPath implements the Dialect interface.
+func (PostgresDialect) JSONHasPath(document string, path []JSONPathElement, value ValueFunc) string {
+	return fmt.Sprintf("jsonb_path_exists(%s, %s)", document, value(jsonPath(path)))
+}
+
+// JSONIsNull implements the Dialect interface.
+func (d PostgresDialect) JSONIsNull(document string, path []JSONPathElement, negated bool, value ValueFunc) string {
+	return fmt.Sprintf("%s %s 'null'::jsonb", d.JSONExtract(document, path, false, value), equalityOperator(negated))
+}
+
+// JSONArrayElements implements the Dialect interface.
+func (PostgresDialect) JSONArrayElements(array, alias string) string {
+	return fmt.Sprintf("jsonb_array_elements(%s) AS %s", array, alias)
+}
+
+// JSONSize implements the Dialect interface.
+func (PostgresDialect) JSONSize(document string) string {
+	return fmt.Sprintf("CASE jsonb_typeof(%[1]s) WHEN 'array' THEN jsonb_array_length(%[1]s) WHEN 'object' THEN (SELECT count(*) FROM jsonb_object_keys(%[1]s)) WHEN 'string' THEN char_length(%[1]s#>>'{}') END", document)
+}
+
+// JSONObjectSize implements the Dialect interface.
+func (PostgresDialect) JSONObjectSize(document string) string {
+	return fmt.Sprintf("(SELECT count(*) FROM jsonb_object_keys(%s))", document)
+}
+
+// StringLength implements the Dialect interface.
+func (PostgresDialect) StringLength(str string) string {
+	return fmt.Sprintf("char_length(%s)", str)
+}
+
+// Contains implements the Dialect interface.
+func (PostgresDialect) Contains(str, substr string) string {
+	return fmt.Sprintf("POSITION(%s IN %s) <> 0", substr, str)
+}
+
+// StartsWith implements the Dialect interface.
+func (PostgresDialect) StartsWith(str, prefix, pattern string) string {
+	return fmt.Sprintf("%s LIKE %s || '%%' ESCAPE '!'", str, pattern)
+}
+
+// EndsWith implements the Dialect interface.
+func (PostgresDialect) EndsWith(str, suffix, pattern string) string {
+	return fmt.Sprintf("%s LIKE '%%' || %s ESCAPE '!'", str, pattern)
+}
+
+// Matches implements the Dialect interface.
+func (PostgresDialect) Matches(str, pattern string) string {
+	return fmt.Sprintf("%s ~ %s", str, pattern)
+}
+
+// TranslateRegexp implements the Dialect interface.
+func (PostgresDialect) TranslateRegexp(pattern string) (string, error) {
+	return translateRegexp(pattern, postgresRegexp)
+}
+
+// LowerASCII implements the ASCIICaseDialect interface. Unlike lower, translate
+// leaves the letters outside of the ASCII range untouched.
+func (PostgresDialect) LowerASCII(str string) string {
+	return fmt.Sprintf("translate(%s, '%s', '%s')", str, upperASCIILetters, lowerASCIILetters)
+}
+
+// UpperASCII implements the ASCIICaseDialect interface.
+func (PostgresDialect) UpperASCII(str string) string {
+	return fmt.Sprintf("translate(%s, '%s', '%s')", str, lowerASCIILetters, upperASCIILetters)
+}
+
+// Trim implements the Dialect interface. Postgres doesn't support the \v
+// escape, so the vertical tab is written as \x0B.
+func (PostgresDialect) Trim(str string) string {
+	return fmt.Sprintf(`btrim(%s, E' \t\n\x0B\f\r')`, str)
+}
+
+// Replace implements the Dialect interface.
+func (PostgresDialect) Replace(str, old, new string) string {
+	return fmt.Sprintf("replace(%s, %s, %s)", str, old, new)
+}
+
+// Substring implements the Dialect interface.
+func (PostgresDialect) Substring(str, start, length string) string {
+	if length == "" {
+		return fmt.Sprintf("substr(%s, %s)", str, start)
+	}
+	return fmt.Sprintf("substr(%s, %s, %s)", str, start, length)
+}
+
+// Position implements the Dialect interface.
+func (PostgresDialect) Position(str, substr string) string {
+	return fmt.Sprintf("strpos(%s, %s)", str, substr)
+}
+
+// Split implements the ArrayDialect interface.
+func (PostgresDialect) Split(str, sep string) string {
+	return fmt.Sprintf("string_to_array(%s, %s)", str, sep)
+}
+
+// ArrayElement implements the ArrayDialect interface.
+func (PostgresDialect) ArrayElement(array, position string) string {
+	return fmt.Sprintf("(%s)[%s]", array, position)
+}
+
+// ArrayLength implements the ArrayDialect interface.
+func (PostgresDialect) ArrayLength(array string) string {
+	return fmt.Sprintf("cardinality(%s)", array)
+}
+
+// ArrayContains implements the ArrayDialect interface.
+func (PostgresDialect) ArrayContains(array, elem string) string {
+	return fmt.Sprintf("%s = ANY(%s)", elem, array)
+}
+
+// Truncate implements the Dialect interface.
+func (PostgresDialect) Truncate(number string) string {
+	return fmt.Sprintf("trunc(%s)", number)
+}
+
+// Extract implements the Dialect interface.
+func (PostgresDialect) Extract(part DatePart, timestamp string) string {
+	switch part {
+	case Second:
+		// The seconds field includes the fractional seconds.
+		return fmt.Sprintf("floor(EXTRACT(SECOND FROM %s))", timestamp)
+
+	case Millisecond:
+		// The milliseconds field includes the seconds.
+		return fmt.Sprintf("mod(floor(EXTRACT(MILLISECONDS FROM %s)), 1000)", timestamp)
+	}
+	return fmt.Sprintf("EXTRACT(%s FROM %s)", part, timestamp)
+}
+
+// AtTimeZone implements the Dialect interface. UTC offsets are passed as
+// intervals, since Postgres would interpret them as POSIX time zones, whose
+// offsets have the opposite sign.
+func (PostgresDialect) AtTimeZone(timestamp, zone string, value ValueFunc) string {
+	if isUTCOffset(zone) {
+		return fmt.Sprintf("(%s AT TIME ZONE %s::INTERVAL)", timestamp, value(zone))
+	}
+	return fmt.Sprintf("(%s AT TIME ZONE %s)", timestamp, value(zone))
+}
+
+// Now implements the Dialect interface.
+func (PostgresDialect) Now() string {
+	return "NOW()"
+}
+
+// AddDuration implements the Dialect interface.
+func (PostgresDialect) AddDuration(timestamp string, duration time.Duration, value ValueFunc) string {
+	operator := "+"
+	if duration < 0 {
+		operator, duration = "-", -duration
+	}
+	return fmt.Sprintf("%s %s %s::INTERVAL", timestamp, operator, value(formatSeconds(duration)+" SECONDS"))
+}
+
+// Interval implements the Dialect interface.
+func (PostgresDialect) Interval(duration time.Duration, value ValueFunc) string {
+	return value(formatSeconds(duration)+" SECONDS") + "::INTERVAL"
+}
+
+// TimestampDiff implements the Dialect interface.
+func (PostgresDialect) TimestampDiff(end, start string) string {
+	return fmt.Sprintf("%s - %s", end, start)
+}
+
+// Cast implements the Dialect interface. Postgres accepts the format of CEL
+// durations as interval input, since h, m, s and ms are valid unit
+// abbreviations.
+func (PostgresDialect) Cast(expr string, to SQLType) string {
+	switch to {
+	case TimestampType:
+		return expr + "::TIMESTAMP WITH TIME ZONE"
+
+	case IntType:
+		return expr + "::BIGINT"
+
+	case DoubleType:
+		return expr + "::DOUBLE PRECISION"
+
+	case BooleanType:
+		return expr + "::BOOLEAN"
+
+	case DurationType:
+		return expr + "::INTERVAL"
+
+	case StringType:
+		return expr + "::TEXT"
+	}
+	return expr
+}
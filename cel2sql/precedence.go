@@ -0,0 +1,84 @@
+package cel2sql
+
+// Precedence levels of the SQL expressions, from the loosest to the tightest
+// binding. The renderer wraps the operands that bind looser than their
+// operator in parentheses, so that the generated SQL keeps the grouping of the
+// CEL expression.
+const (
+	orPrecedence = iota + 1
+	andPrecedence
+	notPrecedence
+	isPrecedence
+	comparisonPrecedence
+	// operatorPrecedence is the precedence of the operators that aren't
+	// defined by the SQL standard, such as the JSON operators of PostgreSQL.
+	operatorPrecedence
+	additivePrecedence
+	multiplicativePrecedence
+	negationPrecedence
+	// castPrecedence is the precedence of PostgreSQL casts, which are the
+	// tightest binding operators the dialects yield.
+	castPrecedence
+	// primaryPrecedence is the precedence of the expressions that never need
+	// to be wrapped in parentheses, such as columns, literals and function
+	// calls.
+	primaryPrecedence
+)
+
+// binaryPrecedences holds the precedence of the SQL binary operators.
+var binaryPrecedences = map[string]int{
+	"OR":  orPrecedence,
+	"AND": andPrecedence,
+	"=":   comparisonPrecedence,
+	"<>":  comparisonPrecedence,
+	"<":   comparisonPrecedence,
+	"<=":  comparisonPrecedence,
+	">":   comparisonPrecedence,
+	">=":  comparisonPrecedence,
+	"IN":  comparisonPrecedence,
+	"+":   additivePrecedence,
+	"-":   additivePrecedence,
+	"*":   multiplicativePrecedence,
+	"/":   multiplicativePrecedence,
+	"%":   multiplicativePrecedence,
+}
+
+// precedenceOf returns the precedence of the provided SQL expression. Since
+// dialects are free to render their expressions with operators, the ones
+// yielded by them are given the loosest precedence they may be rendered with.
+func precedenceOf(expr sqlExpr) int {
+	switch node := expr.(type) {
+	case binaryExpr:
+		return binaryPrecedences[node.op]
+
+	case unaryExpr:
+		switch node.op {
+		case "NOT":
+			return notPrecedence
+		case "-":
+			return negationPrecedence
+		}
+
+	case postfixExpr:
+		return isPrecedence
+
+	case jsonContains, jsonHasPath, jsonIsNull:
+		return comparisonPrecedence
+
+	case jsonExtract:
+		return operatorPrecedence
+
+	case addDuration, timestampDiff:
+		return additivePrecedence
+
+	case cast, interval:
+		return castPrecedence
+
+	case call:
+		switch node.function {
+		case containsFunc, startsWithFunc, endsWithFunc, matchesFunc, arrayContainsFunc:
+			return comparisonPrecedence
+		}
+	}
+	return primaryPrecedence
+}
@@ -0,0 +1,316 @@
+package cel2sql
+
+import (
+	"errors"
+	"fmt"
+	"regexp/syntax"
+	"strings"
+	"unicode"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+const (
+	// maxRegexpRepeat is the largest count of a counted repetition, which is
+	// the limit of Postgres.
+	maxRegexpRepeat = 255
+
+	// maxRegexpInstructions is the size limit of the compiled regular
+	// expressions, which keeps the cost of matching rows at bay.
+	maxRegexpInstructions = 1000
+
+	// maxRegexpClassRanges is the largest number of ranges of a character
+	// class, such as the ones of Unicode classes, which are spelled out in
+	// the translation.
+	maxRegexpClassRanges = 100
+)
+
+// regexpFlavor describes how the constructs of RE2 that aren't portable across
+// regular expression engines are written in the syntax of a dialect.
+type regexpFlavor struct {
+	// anyChar matches any character, including newlines.
+	anyChar string
+
+	// endText matches at the end of the text only.
+	endText string
+
+	// classSpecials are the characters that must be escaped within bracket
+	// expressions.
+	classSpecials string
+}
+
+var (
+	// postgresRegexp is the flavor of Postgres advanced regular expressions,
+	// which aren't newline sensitive by default.
+	postgresRegexp = regexpFlavor{
+		anyChar:       ".",
+		endText:       "$",
+		classSpecials: `\]-^[`,
+	}
+
+	// icuRegexp is the flavor of the ICU regular expressions used by MySQL, in
+	// which the dot doesn't match line terminators and the dollar matches
+	// before a trailing one.
+	icuRegexp = regexpFlavor{
+		anyChar:       "(?s:.)",
+		endText:       `\z`,
+		classSpecials: `\]-^[&`,
+	}
+)
+
+// interpretMatchesFunction translates the matches function. The pattern must
+// be a constant, so that it can be validated and translated into the syntax of
+// the dialect.
+func (i *interpreter) interpretMatchesFunction(expr *exprpb.Expr_CallExpr) (sqlExpr, error) {
+	target, args := targetAndArgs(expr)
+	constant, ok := args[0].GetConstExpr().GetConstantKind().(*exprpb.Constant_StringValue)
+	if !ok {
+		return nil, i.unsupportedExprError(args[0].GetId(), "non-constant pattern")
+	}
+	pattern, err := i.dialect.TranslateRegexp(constant.StringValue)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", i.unsupportedExprError(args[0].GetId(), "regular expression"), err)
+	}
+
+	str, err := i.interpretExpr(target)
+	if err != nil {
+		return nil, err
+	}
+	return call{matchesFunc, []sqlExpr{str, literal{pattern}}}, nil
+}
+
+// parseRegexp parses the RE2 regular expression and checks that it isn't too
+// expensive to match.
+func parseRegexp(pattern string) (*syntax.Regexp, error) {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return nil, err
+	}
+	prog, err := syntax.Compile(re.Simplify())
+	if err != nil {
+		return nil, err
+	}
+	if len(prog.Inst) > maxRegexpInstructions {
+		return nil, errors.New("the regular expression is too expensive")
+	}
+	return re, nil
+}
+
+// translateRegexp translates the RE2 regular expression into the provided
+// flavor. The constructs whose semantics can't be reproduced, such as word
+// boundaries and multi-line anchors, are rejected.
+func translateRegexp(pattern string, flavor regexpFlavor) (string, error) {
+	re, err := parseRegexp(pattern)
+	if err != nil {
+		return "", err
+	}
+	var translation strings.Builder
+	if err := flavor.write(&translation, re); err != nil {
+		return "", err
+	}
+	return translation.String(), nil
+}
+
+func (f regexpFlavor) write(b *strings.Builder, re *syntax.Regexp) error {
+	switch re.Op {
+	case syntax.OpEmptyMatch:
+		b.WriteString("()")
+
+	case syntax.OpLiteral:
+		for _, r := range re.Rune {
+			if err := f.writeLiteral(b, r, re.Flags&syntax.FoldCase != 0); err != nil {
+				return err
+			}
+		}
+
+	case syntax.OpCharClass:
+		return f.writeClass(b, re.Rune)
+
+	case syntax.OpAnyCharNotNL:
+		b.WriteString(`[^\n]`)
+
+	case syntax.OpAnyChar:
+		b.WriteString(f.anyChar)
+
+	case syntax.OpBeginText:
+		b.WriteString("^")
+
+	case syntax.OpEndText:
+		b.WriteString(f.endText)
+
+	case syntax.OpCapture:
+		b.WriteString("(")
+		if err := f.write(b, re.Sub[0]); err != nil {
+			return err
+		}
+		b.WriteString(")")
+
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		// Greediness is irrelevant, since only the existence of a match is
+		// checked.
+		if err := f.writeAtom(b, re.Sub[0]); err != nil {
+			return err
+		}
+		switch re.Op {
+		case syntax.OpStar:
+			b.WriteString("*")
+		case syntax.OpPlus:
+			b.WriteString("+")
+		case syntax.OpQuest:
+			b.WriteString("?")
+		default:
+			if re.Min > maxRegexpRepeat || re.Max > maxRegexpRepeat {
+				return fmt.Errorf("repetition counts can't exceed %d", maxRegexpRepeat)
+			}
+			switch {
+			case re.Max == -1:
+				fmt.Fprintf(b, "{%d,}", re.Min)
+			case re.Min == re.Max:
+				fmt.Fprintf(b, "{%d}", re.Min)
+			default:
+				fmt.Fprintf(b, "{%d,%d}", re.Min, re.Max)
+			}
+		}
+
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			write := f.write
+			if sub.Op == syntax.OpAlternate {
+				write = f.writeAtom
+			}
+			if err := write(b, sub); err != nil {
+				return err
+			}
+		}
+
+	case syntax.OpAlternate:
+		for index, sub := range re.Sub {
+			if index > 0 {
+				b.WriteString("|")
+			}
+			if err := f.write(b, sub); err != nil {
+				return err
+			}
+		}
+
+	case syntax.OpBeginLine, syntax.OpEndLine:
+		return errors.New("multi-line anchors aren't supported")
+
+	case syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+		return errors.New("word boundaries aren't supported")
+
+	default:
+		return errors.New("the regular expression never matches")
+	}
+	return nil
+}
+
+// writeAtom writes the regular expression so that it can be quantified or
+// concatenated, wrapping it in a non-capturing group if needed.
+func (f regexpFlavor) writeAtom(b *strings.Builder, re *syntax.Regexp) error {
+	switch {
+	case re.Op == syntax.OpLiteral && len(re.Rune) == 1,
+		re.Op == syntax.OpCharClass, re.Op == syntax.OpAnyChar, re.Op == syntax.OpAnyCharNotNL,
+		re.Op == syntax.OpCapture, re.Op == syntax.OpEmptyMatch:
+		return f.write(b, re)
+	}
+	b.WriteString("(?:")
+	if err := f.write(b, re); err != nil {
+		return err
+	}
+	b.WriteString(")")
+	return nil
+}
+
+// writeLiteral writes a literal character, or a bracket expression that
+// matches all of its cases if the case must be folded.
+func (f regexpFlavor) writeLiteral(b *strings.Builder, r rune, foldCase bool) error {
+	if r == 0 {
+		return errors.New("NUL characters aren't supported")
+	}
+	if foldCase {
+		if folded := unicode.SimpleFold(r); folded != r {
+			b.WriteString("[")
+			for c := r; ; {
+				f.writeClassChar(b, c)
+				if c = unicode.SimpleFold(c); c == r {
+					break
+				}
+			}
+			b.WriteString("]")
+			return nil
+		}
+	}
+	if strings.ContainsRune(`\.+*?()|[]{}^$`, r) {
+		b.WriteString(`\`)
+	}
+	writeChar(b, r)
+	return nil
+}
+
+// writeClass writes a bracket expression that matches the provided ranges.
+// Since NUL characters can't be stored in text columns, classes that include
+// every other character are written as negated bracket expressions.
+func (f regexpFlavor) writeClass(b *strings.Builder, ranges []rune) error {
+	if len(ranges) == 0 {
+		return errors.New("the regular expression never matches")
+	}
+	if ranges[0] <= 1 && ranges[len(ranges)-1] == unicode.MaxRune {
+		var complement []rune
+		for index := 1; index+1 < len(ranges); index += 2 {
+			complement = append(complement, ranges[index]+1, ranges[index+1]-1)
+		}
+		if len(complement) == 0 {
+			b.WriteString(f.anyChar)
+			return nil
+		}
+		if len(complement) > 2*maxRegexpClassRanges {
+			return errors.New("the character class is too large")
+		}
+		b.WriteString("[^")
+		f.writeRanges(b, complement)
+		b.WriteString("]")
+		return nil
+	}
+
+	if len(ranges) > 2*maxRegexpClassRanges {
+		return errors.New("the character class is too large")
+	}
+	if ranges[0] == 0 {
+		ranges = append([]rune{1}, ranges[1:]...)
+	}
+	b.WriteString("[")
+	f.writeRanges(b, ranges)
+	b.WriteString("]")
+	return nil
+}
+
+func (f regexpFlavor) writeRanges(b *strings.Builder, ranges []rune) {
+	for index := 0; index+1 < len(ranges); index += 2 {
+		lo, hi := ranges[index], ranges[index+1]
+		f.writeClassChar(b, lo)
+		if hi != lo {
+			b.WriteString("-")
+			f.writeClassChar(b, hi)
+		}
+	}
+}
+
+func (f regexpFlavor) writeClassChar(b *strings.Builder, r rune) {
+	if strings.ContainsRune(f.classSpecials, r) {
+		b.WriteString(`\`)
+	}
+	writeChar(b, r)
+}
+
+// writeChar writes the character, escaping it if it isn't printable.
+func writeChar(b *strings.Builder, r rune) {
+	switch {
+	case unicode.IsPrint(r):
+		b.WriteRune(r)
+	case r <= 0xFFFF:
+		fmt.Fprintf(b, `\u%04X`, r)
+	default:
+		fmt.Fprintf(b, `\U%08X`, r)
+	}
+}
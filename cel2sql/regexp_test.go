@@ -0,0 +1,56 @@
+package cel2sql
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTranslateRegexp(t *testing.T) {
+	tests := []struct {
+		in       string
+		want     string
+		wantICU  string
+		wantFail bool
+	}{
+		{in: `^foo.*$`, want: `^foo[^\n]*$`, wantICU: `^foo[^\n]*\z`},
+		{in: `(?i)ab`, want: `[Aa][Bb]`, wantICU: `[Aa][Bb]`},
+		{in: `\d+`, want: `[0-9]+`, wantICU: `[0-9]+`},
+		{in: `(?s)a.c`, want: `a.c`, wantICU: `a(?s:.)c`},
+		{in: `^[^a-z]$`, want: `^[^a-z]$`, wantICU: `^[^a-z]\z`},
+		{in: `a|b+?`, want: `a|b+`, wantICU: `a|b+`},
+		{in: `[\x00-\x1f]`, want: `[\u0001-\u001F]`, wantICU: `[\u0001-\u001F]`},
+		{in: `\bfoo`, wantFail: true},
+		{in: `(?m)^foo$`, wantFail: true},
+		{in: `a{1000}`, wantFail: true},
+		{in: `[^\x00-\x{10FFFF}]`, wantFail: true},
+		{in: `\pL`, wantFail: true},
+		{in: `(a`, wantFail: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.in, func(t *testing.T) {
+			got, err := translateRegexp(test.in, postgresRegexp)
+			gotICU, errICU := translateRegexp(test.in, icuRegexp)
+			if test.wantFail {
+				if err == nil || errICU == nil {
+					t.Fatalf("Want an error, but got %q and %q", got, gotICU)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if errICU != nil {
+				t.Fatal(errICU)
+			}
+
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("Mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(test.wantICU, gotICU); diff != "" {
+				t.Errorf("ICU mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
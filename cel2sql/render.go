@@ -0,0 +1,342 @@
+package cel2sql
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// renderer writes SQL expression trees as SQL in the configured dialect.
+type renderer struct {
+	dialect Dialect
+
+	// parameterize indicates whether literal values must be replaced with
+	// placeholders and collected into vars instead of being inlined.
+	parameterize bool
+	placeholder  PlaceholderStyle
+	vars         []any
+}
+
+// renderSQL renders the whole expression tree. When parameterizing, the bound
+// variables are collected into vars in the same order as their placeholders.
+func (r *renderer) renderSQL(expr sqlExpr) string {
+	query := r.render(expr)
+	if r.parameterize {
+		query = r.bindPlaceholders(query)
+	}
+	return query
+}
+
+func (r *renderer) render(expr sqlExpr) string {
+	switch node := expr.(type) {
+	case column:
+		return node.name
+
+	case literal:
+		return r.renderLiteral(node)
+
+	case raw:
+		return node.sql
+
+	case paren:
+		return "(" + r.render(node.expr) + ")"
+
+	case unaryExpr:
+		return r.renderUnaryExpr(node)
+
+	case postfixExpr:
+		return r.renderOperand(node.operand, precedenceOf(node.operand) <= isPrecedence) + " " + node.op
+
+	case binaryExpr:
+		return r.renderBinaryExpr(node)
+
+	case list:
+		elements := make([]string, 0, len(node.elements))
+		for _, elem := range node.elements {
+			elements = append(elements, r.render(elem))
+		}
+		return "(" + strings.Join(elements, ", ") + ")"
+
+	case caseExpr:
+		return fmt.Sprintf("CASE WHEN %s THEN %s ELSE %s END", r.render(node.when), r.render(node.then), r.render(node.otherwise))
+
+	case cast:
+		return r.dialect.Cast(r.renderArg(node.expr), node.to)
+
+	case jsonExtract:
+		return r.dialect.JSONExtract(r.renderArg(node.document), node.path, node.asText, r.value)
+
+	case jsonContains:
+		// Nested maps of JSON scalars can always be marshaled.
+		candidate, _ := json.Marshal(node.candidate)
+		return r.dialect.(JSONContainmentDialect).JSONContains(r.renderArg(node.document), r.value(string(candidate)))
+
+	case jsonHasPath:
+		return r.dialect.JSONHasPath(r.renderArg(node.document), node.path, r.value)
+
+	case jsonIsNull:
+		return r.dialect.JSONIsNull(r.renderArg(node.document), node.path, node.negated, r.value)
+
+	case extract:
+		return r.dialect.Extract(node.part, r.renderArg(node.timestamp))
+
+	case atTimeZone:
+		return r.dialect.AtTimeZone(r.renderArg(node.timestamp), node.zone, r.value)
+
+	case currentTimestamp:
+		return r.dialect.Now()
+
+	case addDuration:
+		return r.dialect.AddDuration(r.renderArg(node.timestamp), node.duration, r.value)
+
+	case timestampDiff:
+		return r.dialect.TimestampDiff(r.renderArg(node.end), r.renderArg(node.start))
+
+	case interval:
+		return r.dialect.Interval(node.duration, r.value)
+
+	case call:
+		return r.renderCall(node)
+
+	case customCall:
+		args := make([]string, 0, len(node.args))
+		for _, arg := range node.args {
+			args = append(args, r.renderArg(arg))
+		}
+		return node.function.render(r.dialect, args)
+
+	case subquery:
+		query := fmt.Sprintf("(SELECT %s FROM %s", r.render(node.selection), r.dialect.JSONArrayElements(r.renderArg(node.array), node.alias))
+		if node.where != nil {
+			query += " WHERE " + r.render(node.where)
+		}
+		return query + ")"
+	}
+	panic(fmt.Sprintf("cel2sql: unknown SQL expression %T", expr))
+}
+
+// renderUnaryExpr renders the provided prefix operator, wrapping its operand
+// in parentheses if it binds looser than the operator.
+func (r *renderer) renderUnaryExpr(node unaryExpr) string {
+	if node.op != "-" {
+		return node.op + " " + r.renderOperand(node.operand, precedenceOf(node.operand) < notPrecedence)
+	}
+	operand := r.renderOperand(node.operand, precedenceOf(node.operand) < negationPrecedence)
+	if strings.HasPrefix(operand, "-") {
+		// Two consecutive minus signs start a comment.
+		operand = "(" + operand + ")"
+	}
+	return node.op + operand
+}
+
+// renderBinaryExpr renders the provided binary operator, wrapping its operands
+// in parentheses if they bind looser than the operator. Operands that bind as
+// tight as the operator are wrapped as well, unless the grouping is implied by
+// the left associativity of the operator or doesn't matter, like in chains of
+// conjunctions. Comparisons aren't associative at all.
+func (r *renderer) renderBinaryExpr(node binaryExpr) string {
+	precedence := binaryPrecedences[node.op]
+	leftPrecedence := precedenceOf(node.left)
+	left := r.renderOperand(node.left, leftPrecedence < precedence ||
+		leftPrecedence == precedence && precedence == comparisonPrecedence)
+
+	rightPrecedence := precedenceOf(node.right)
+	right := r.renderOperand(node.right, rightPrecedence < precedence ||
+		rightPrecedence == precedence && !isSameLogicalOperator(node, node.right))
+
+	return left + " " + node.op + " " + right
+}
+
+// isSameLogicalOperator returns true if both expressions are conjunctions or
+// disjunctions.
+func isSameLogicalOperator(expr binaryExpr, other sqlExpr) bool {
+	node, ok := other.(binaryExpr)
+	return ok && node.op == expr.op && (expr.op == "AND" || expr.op == "OR")
+}
+
+// renderOperand renders the provided operand, wrapped in parentheses if
+// requested.
+func (r *renderer) renderOperand(expr sqlExpr, wrap bool) string {
+	if wrap {
+		return "(" + r.render(expr) + ")"
+	}
+	return r.render(expr)
+}
+
+// renderArg renders an operand of an expression rendered by the dialect. Since
+// dialects may embed it into any operator, it's wrapped in parentheses unless
+// it binds as tight as a cast.
+func (r *renderer) renderArg(expr sqlExpr) string {
+	return r.renderOperand(expr, precedenceOf(expr) < castPrecedence)
+}
+
+func (r *renderer) renderLiteral(node literal) string {
+	switch v := node.value.(type) {
+	case nil:
+		return "NULL"
+
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	}
+	return r.value(node.value)
+}
+
+func (r *renderer) renderCall(node call) string {
+	args := make([]string, 0, len(node.args))
+	for _, arg := range node.args {
+		args = append(args, r.renderArg(arg))
+	}
+
+	switch node.function {
+	case stringLengthFunc:
+		return r.dialect.StringLength(args[0])
+
+	case jsonSizeFunc:
+		return r.dialect.JSONSize(args[0])
+
+	case jsonObjectSizeFunc:
+		return r.dialect.JSONObjectSize(args[0])
+
+	case containsFunc:
+		return r.dialect.Contains(args[0], args[1])
+
+	case startsWithFunc:
+		return r.dialect.StartsWith(args[0], args[1], r.likePattern(node.args[1], args[1]))
+
+	case endsWithFunc:
+		return r.dialect.EndsWith(args[0], args[1], r.likePattern(node.args[1], args[1]))
+
+	case matchesFunc:
+		return r.dialect.Matches(args[0], args[1])
+
+	case lowerFunc:
+		// The interpreter makes sure that the dialect can change the
+		// case of ASCII letters.
+		return r.dialect.(ASCIICaseDialect).LowerASCII(args[0])
+
+	case upperFunc:
+		return r.dialect.(ASCIICaseDialect).UpperASCII(args[0])
+
+	case trimFunc:
+		return r.dialect.Trim(args[0])
+
+	case replaceFunc:
+		return r.dialect.Replace(args[0], args[1], args[2])
+
+	case substringFunc:
+		if len(args) == 2 {
+			return r.dialect.Substring(args[0], args[1], "")
+		}
+		return r.dialect.Substring(args[0], args[1], args[2])
+
+	case positionFunc:
+		return r.dialect.Position(args[0], args[1])
+
+	case truncateFunc:
+		return r.dialect.Truncate(args[0])
+	}
+
+	// The interpreter makes sure that array functions are only used with
+	// dialects that support them.
+	arrayDialect := r.dialect.(ArrayDialect)
+	switch node.function {
+	case splitFunc:
+		return arrayDialect.Split(args[0], args[1])
+
+	case arrayElementFunc:
+		return arrayDialect.ArrayElement(args[0], args[1])
+
+	case arrayLengthFunc:
+		return arrayDialect.ArrayLength(args[0])
+
+	case arrayContainsFunc:
+		return arrayDialect.ArrayContains(args[0], args[1])
+	}
+	panic(fmt.Sprintf("cel2sql: unknown SQL function %d", node.function))
+}
+
+// likeEscaper escapes the wildcards of the LIKE operator, as well as the escape
+// character itself.
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// likePattern returns a LIKE pattern that matches the provided string
+// literally, given the expression and its rendering. Literals are escaped right
+// away, whereas other strings are escaped by the database.
+func (r *renderer) likePattern(expr sqlExpr, rendered string) string {
+	if node, ok := expr.(literal); ok {
+		if str, ok := node.value.(string); ok {
+			return r.value(likeEscaper.Replace(str))
+		}
+	}
+	for _, wildcard := range []string{"!", "%", "_"} {
+		rendered = r.dialect.Replace(rendered, quoteString(wildcard), quoteString("!"+wildcard))
+	}
+	return rendered
+}
+
+// value returns the SQL representation of the provided value. When the
+// renderer is parameterizing the query, the value is appended to the bound
+// variables and a marker referencing it is returned. Markers are replaced with
+// placeholders once the whole query is rendered, since dialects are free to
+// reorder or repeat operands. Otherwise, the value is returned as an escaped
+// SQL literal.
+func (r *renderer) value(value any) string {
+	if r.parameterize {
+		r.vars = append(r.vars, value)
+		return fmt.Sprintf("%c%d%[1]c", varMarker, len(r.vars)-1)
+	}
+
+	switch v := value.(type) {
+	case string:
+		if quoter, ok := r.dialect.(StringQuoter); ok {
+			return quoter.QuoteString(v)
+		}
+		return quoteString(v)
+
+	case float64:
+		// Doubles keep their decimal point, so that SQL doesn't switch to
+		// integer arithmetic.
+		str := strconv.FormatFloat(v, 'f', -1, 64)
+		if !strings.Contains(str, ".") {
+			str += ".0"
+		}
+		return str
+
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// varMarker delimits references to bound variables in the SQL statement being
+// rendered.
+const varMarker = '\x00'
+
+// bindPlaceholders replaces the references to bound variables in the query
+// with placeholders. The bound variables are then rearranged to match the
+// order in which they are referenced.
+func (r *renderer) bindPlaceholders(query string) string {
+	var result strings.Builder
+	vars := make([]any, 0, len(r.vars))
+	parts := strings.Split(query, string(varMarker))
+	for index, part := range parts {
+		if index%2 == 0 {
+			result.WriteString(part)
+			continue
+		}
+		position, _ := strconv.Atoi(part)
+		vars = append(vars, r.vars[position])
+		result.WriteString(r.placeholder.format(len(vars)))
+	}
+	r.vars = vars
+	return result.String()
+}
+
+// quoteString returns the provided string as a SQL string literal, escaping
+// embedded single quotes.
+func quoteString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
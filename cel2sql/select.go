@@ -1,29 +1,95 @@
 package cel2sql
 
 import (
-	"fmt"
-
-	"gorm.io/gorm/schema"
+	"github.com/google/cel-go/common/operators"
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
 )
 
-// translateToJSONAccessors converts the provided field path to a Postgres JSON
-// property selection directive. This allows us to yield appropriate SQL
-// expressions to navigate through the record.data field, for instance.
-func (i *interpreter) translateToJSONAccessors(fieldPath []string) {
-	firstField := fieldPath[0]
-	lastField := fieldPath[len(fieldPath)-1]
-
-	fmt.Fprintf(&i.query, "(%s->", firstField)
-	if len(fieldPath) > 2 {
-		for _, field := range fieldPath[1 : len(fieldPath)-1] {
-			fmt.Fprintf(&i.query, "'%s'->", field)
+// translateToJSONAccessors converts the provided JSON path to a JSON property
+// selection directive. This allows us to yield appropriate SQL expressions to
+// navigate through the record.data field, for instance.
+func translateToJSONAccessors(root string, path []JSONPathElement) sqlExpr {
+	return paren{jsonExtract{document: column{root}, path: path, asText: true}}
+}
+
+// jsonPathOf returns the root identifier of the chain of field selections and
+// index operations that make up the provided expression, such as
+// data.spec.params[0].value, along with the JSON path they navigate from it.
+// The root is the column that holds the identifier, or the innermost field
+// selection, according to the mapping. Iteration variables are rooted at the
+// alias bound to the elements they iterate over.
+// Indices must be constant strings, which select the keys of JSON objects, or
+// constant integers, which select the elements of JSON arrays.
+func (i *interpreter) jsonPathOf(expr *exprpb.Expr) (string, []JSONPathElement, error) {
+	if name, ok := i.mappedColumnOf(expr); ok {
+		return name, nil, nil
+	}
+
+	switch node := expr.ExprKind.(type) {
+	case *exprpb.Expr_IdentExpr:
+		name := node.IdentExpr.GetName()
+		if alias, ok := i.iterVarAlias(name); ok {
+			return alias, nil, nil
+		}
+		return name, nil, nil
+
+	case *exprpb.Expr_SelectExpr:
+		if node.SelectExpr.GetTestOnly() {
+			break
+		}
+		root, path, err := i.jsonPathOf(node.SelectExpr.GetOperand())
+		if err != nil {
+			return "", nil, err
+		}
+		return root, append(path, jsonKey(node.SelectExpr.GetField())), nil
+
+	case *exprpb.Expr_CallExpr:
+		args := node.CallExpr.GetArgs()
+		if node.CallExpr.GetFunction() != operators.Index {
+			break
 		}
+		root, path, err := i.jsonPathOf(args[0])
+		if err != nil {
+			return "", nil, err
+		}
+		elem, err := i.jsonPathElementOf(args[1])
+		if err != nil {
+			return "", nil, err
+		}
+		return root, append(path, elem), nil
+	}
+	return "", nil, i.unsupportedExprError(expr.GetId(), "JSON path")
+}
+
+// jsonPathElementOf returns the path element selected by the provided index,
+// which must be constant.
+func (i *interpreter) jsonPathElementOf(index *exprpb.Expr) (JSONPathElement, error) {
+	switch constant := index.GetConstExpr().GetConstantKind().(type) {
+	case *exprpb.Constant_StringValue:
+		return jsonKey(constant.StringValue), nil
+
+	case *exprpb.Constant_Int64Value:
+		if constant.Int64Value < 0 {
+			return JSONPathElement{}, i.unsupportedExprError(index.GetId(), "negative index")
+		}
+		return jsonIndex(constant.Int64Value), nil
+
+	case *exprpb.Constant_Uint64Value:
+		return jsonIndex(int64(constant.Uint64Value)), nil
 	}
-	fmt.Fprintf(&i.query, ">'%s')", lastField)
+	return JSONPathElement{}, i.unsupportedExprError(index.GetId(), "non-constant index")
 }
 
-// translateIntoRecordSummaryColum
-func (i *interpreter) translateIntoRecordSummaryColum(fieldPath []string) {
-	namer := &schema.NamingStrategy{}
-	fmt.Fprintf(&i.query, "recordsummary_%s", namer.ColumnName("", fieldPath[1]))
+// interpretJSONExpr translates the provided dyn expression into a SQL
+// expression that yields a JSON value, rather than the text yielded by the JSON
+// accessors used elsewhere. It's useful to feed JSON functions.
+func (i *interpreter) interpretJSONExpr(expr *exprpb.Expr) (sqlExpr, error) {
+	root, path, err := i.jsonPathOf(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(path) == 0 {
+		return column{root}, nil
+	}
+	return paren{jsonExtract{document: column{root}, path: path}}, nil
 }
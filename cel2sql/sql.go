@@ -0,0 +1,206 @@
+package cel2sql
+
+import (
+	"time"
+)
+
+// sqlExpr is a node of the SQL expression tree built by the interpreter out of
+// the CEL AST. The tree is independent of the SQL dialect and of whether
+// values are inlined or bound to placeholders; both concerns are handled by
+// the renderer.
+type sqlExpr interface {
+	sqlExpr()
+}
+
+// column references a table column or a table alias, such as the one bound to
+// the elements of a JSON array.
+type column struct {
+	name string
+}
+
+// literal is a constant value. Strings and numbers are either inlined as
+// escaped SQL literals or bound to placeholders, whereas nil and booleans are
+// always written as SQL keywords.
+type literal struct {
+	value any
+}
+
+// raw is a fragment of SQL written verbatim, such as `count(*)`. It must never
+// hold user provided values.
+type raw struct {
+	sql string
+}
+
+// paren groups the enclosed expression.
+type paren struct {
+	expr sqlExpr
+}
+
+// unaryExpr is an expression made up of a prefix operator, such as NOT, and
+// its operand.
+type unaryExpr struct {
+	op      string
+	operand sqlExpr
+}
+
+// postfixExpr is an expression made up of its operand followed by a postfix
+// operator, such as IS NOT NULL.
+type postfixExpr struct {
+	operand sqlExpr
+	op      string
+}
+
+// binaryExpr is an expression made up of an infix operator and its operands.
+type binaryExpr struct {
+	op          string
+	left, right sqlExpr
+}
+
+// list is a parenthesized list of expressions, as used by the IN operator.
+type list struct {
+	elements []sqlExpr
+}
+
+// caseExpr is a searched CASE expression with a single WHEN clause.
+type caseExpr struct {
+	when, then, otherwise sqlExpr
+}
+
+// cast converts the expression to the provided SQL type.
+type cast struct {
+	expr sqlExpr
+	to   SQLType
+}
+
+// jsonExtract selects the value found at the path in the JSON document, either
+// as text or as a JSON value.
+type jsonExtract struct {
+	document sqlExpr
+	path     []JSONPathElement
+	asText   bool
+}
+
+// jsonContains checks whether the JSON document contains the candidate, which
+// is made up of nested objects whose innermost values are JSON scalars.
+type jsonContains struct {
+	document  sqlExpr
+	candidate any
+}
+
+// jsonHasPath checks whether the path exists in the JSON document.
+type jsonHasPath struct {
+	document sqlExpr
+	path     []JSONPathElement
+}
+
+// jsonIsNull checks whether the value at the path of the JSON document is an
+// explicit JSON null or, if negated, any other JSON value.
+type jsonIsNull struct {
+	document sqlExpr
+	path     []JSONPathElement
+	negated  bool
+}
+
+// extract yields the numeric value of the provided part of a timestamp.
+type extract struct {
+	part      DatePart
+	timestamp sqlExpr
+}
+
+// atTimeZone converts the timestamp to the local time of the time zone.
+type atTimeZone struct {
+	timestamp sqlExpr
+	zone      string
+}
+
+// currentTimestamp yields the current time of the database.
+type currentTimestamp struct{}
+
+// addDuration adds the duration to the timestamp, or subtracts it if the
+// duration is negative.
+type addDuration struct {
+	timestamp sqlExpr
+	duration  time.Duration
+}
+
+// timestampDiff is the duration elapsed from the start timestamp to the end
+// one.
+type timestampDiff struct {
+	end   sqlExpr
+	start sqlExpr
+}
+
+// interval is a constant duration.
+type interval struct {
+	duration time.Duration
+}
+
+// function enumerates the functions whose syntax is determined by the
+// dialect.
+type function int
+
+const (
+	stringLengthFunc function = iota
+	jsonSizeFunc
+	jsonObjectSizeFunc
+	containsFunc
+	startsWithFunc
+	endsWithFunc
+	matchesFunc
+	lowerFunc
+	upperFunc
+	trimFunc
+	replaceFunc
+	substringFunc
+	positionFunc
+	truncateFunc
+	splitFunc
+	arrayElementFunc
+	arrayLengthFunc
+	arrayContainsFunc
+)
+
+// call is a call to one of the functions provided by the dialect.
+type call struct {
+	function function
+	args     []sqlExpr
+}
+
+// customCall calls a custom function.
+type customCall struct {
+	function *Function
+	args     []sqlExpr
+}
+
+// subquery selects the expression from the elements of a JSON array, which
+// are bound to the alias, optionally filtered by the where condition.
+type subquery struct {
+	selection sqlExpr
+	array     sqlExpr
+	alias     string
+	where     sqlExpr
+}
+
+func (column) sqlExpr()           {}
+func (literal) sqlExpr()          {}
+func (raw) sqlExpr()              {}
+func (paren) sqlExpr()            {}
+func (unaryExpr) sqlExpr()        {}
+func (postfixExpr) sqlExpr()      {}
+func (binaryExpr) sqlExpr()       {}
+func (list) sqlExpr()             {}
+func (caseExpr) sqlExpr()         {}
+func (cast) sqlExpr()             {}
+func (jsonExtract) sqlExpr()      {}
+func (jsonContains) sqlExpr()     {}
+func (jsonHasPath) sqlExpr()      {}
+func (jsonIsNull) sqlExpr()       {}
+func (extract) sqlExpr()          {}
+func (atTimeZone) sqlExpr()       {}
+func (currentTimestamp) sqlExpr() {}
+func (addDuration) sqlExpr()      {}
+func (timestampDiff) sqlExpr()    {}
+func (interval) sqlExpr()         {}
+func (call) sqlExpr()             {}
+func (customCall) sqlExpr()       {}
+func (subquery) sqlExpr()         {}
@@ -0,0 +1,279 @@
+package cel2sql
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// SQLiteDialect translates CEL expressions into SQLite SQL. JSON values are
+// expected to be stored as text and timestamps as ISO-8601 strings. The
+// matches function is translated into the REGEXP operator, which requires a
+// user function named regexp to be registered in the connection (see
+// SQLiteRegexp). Likewise, timezone arguments of the timestamp accessors
+// require the at_time_zone user function (see SQLiteAtTimeZone) and the
+// coercion of values to durations requires the duration_seconds user function
+// (see SQLiteDurationSeconds).
+type SQLiteDialect struct{}
+
+// JSONExtract implements the Dialect interface.
+func (SQLiteDialect) JSONExtract(document string, path []JSONPathElement, asText bool, value ValueFunc) string {
+	if len(path) == 0 {
+		return document
+	}
+	if asText {
+		return fmt.Sprintf("json_extract(%s, %s)", document, value(jsonPath(path)))
+	}
+	return fmt.Sprintf("%s -> %s", document, value(jsonPath(path)))
+}
+
+// JSONContains implements the JSONContainmentDialect interface. The types and
+// values of the scalars of the candidate are compared with the ones found at
+// the same paths in the document.
+func (SQLiteDialect) JSONContains(document, candidate string) string {
+	return fmt.Sprintf("NOT EXISTS (SELECT 1 FROM json_tree(%s) AS expected WHERE expected.atom IS NOT NULL AND (json_type(%[2]s, expected.fullkey) IS NOT expected.type OR json_extract(%[2]s, expected.fullkey) <> expected.atom))", candidate, document)
+}
+
+// JSONHasPath implements the Dialect interface.
+func (SQLiteDialect) JSONHasPath(document string, path []JSONPathElement, value ValueFunc) string {
+	return fmt.Sprintf("json_type(%s, %s) IS NOT NULL", document, value(jsonPath(path)))
+}
+
+// JSONIsNull implements the Dialect interface. Since the elements of JSON
+// arrays are yielded as SQL values, a document without a path is checked to be
+// NULL.
+func (SQLiteDialect) JSONIsNull(document string, path []JSONPathElement, negated bool, value ValueFunc) string {
+	if len(path) == 0 {
+		if negated {
+			return document + " IS NOT NULL"
+		}
+		return document + " IS NULL"
+	}
+	return fmt.Sprintf("json_type(%s, %s) %s 'null'", document, value(jsonPath(path)), equalityOperator(negated))
+}
+
+// JSONArrayElements implements the Dialect interface.
+func (SQLiteDialect) JSONArrayElements(array, alias string) string {
+	return fmt.Sprintf("(SELECT value AS %[2]s FROM json_each(%[1]s)) AS %[2]s", array, alias)
+}
+
+// JSONSize implements the Dialect interface.
+func (SQLiteDialect) JSONSize(document string) string {
+	return fmt.Sprintf("CASE json_type(%[1]s) WHEN 'array' THEN json_array_length(%[1]s) WHEN 'object' THEN (SELECT count(*) FROM json_each(%[1]s)) WHEN 'text' THEN length(json_extract(%[1]s, '$')) END", document)
+}
+
+// JSONObjectSize implements the Dialect interface.
+func (SQLiteDialect) JSONObjectSize(document string) string {
+	return fmt.Sprintf("(SELECT count(*) FROM json_each(%s))", document)
+}
+
+// StringLength implements the Dialect interface.
+func (SQLiteDialect) StringLength(str string) string {
+	return fmt.Sprintf("length(%s)", str)
+}
+
+// Contains implements the Dialect interface.
+func (SQLiteDialect) Contains(str, substr string) string {
+	return fmt.Sprintf("instr(%s, %s) <> 0", str, substr)
+}
+
+// StartsWith implements the Dialect interface. The LIKE operator isn't used
+// because it's case insensitive in SQLite.
+func (SQLiteDialect) StartsWith(str, prefix, pattern string) string {
+	return fmt.Sprintf("substr(%s, 1, length(%[2]s)) = %[2]s", str, prefix)
+}
+
+// EndsWith implements the Dialect interface.
+func (SQLiteDialect) EndsWith(str, suffix, pattern string) string {
+	return fmt.Sprintf("(%[2]s = '' OR substr(%[1]s, -length(%[2]s)) = %[2]s)", str, suffix)
+}
+
+// Matches implements the Dialect interface.
+func (SQLiteDialect) Matches(str, pattern string) string {
+	return fmt.Sprintf("%s REGEXP %s", str, pattern)
+}
+
+// TranslateRegexp implements the Dialect interface. Since the regexp user
+// function matches RE2 regular expressions, they're only validated.
+func (SQLiteDialect) TranslateRegexp(pattern string) (string, error) {
+	if _, err := parseRegexp(pattern); err != nil {
+		return "", err
+	}
+	return pattern, nil
+}
+
+// LowerASCII implements the ASCIICaseDialect interface. The lower function of
+// SQLite only converts ASCII letters, unless SQLite is built with ICU.
+func (SQLiteDialect) LowerASCII(str string) string {
+	return fmt.Sprintf("lower(%s)", str)
+}
+
+// UpperASCII implements the ASCIICaseDialect interface.
+func (SQLiteDialect) UpperASCII(str string) string {
+	return fmt.Sprintf("upper(%s)", str)
+}
+
+// Trim implements the Dialect interface.
+func (SQLiteDialect) Trim(str string) string {
+	return fmt.Sprintf("trim(%s, ' ' || char(9, 10, 11, 12, 13))", str)
+}
+
+// Replace implements the Dialect interface.
+func (SQLiteDialect) Replace(str, old, new string) string {
+	return fmt.Sprintf("replace(%s, %s, %s)", str, old, new)
+}
+
+// Substring implements the Dialect interface.
+func (SQLiteDialect) Substring(str, start, length string) string {
+	if length == "" {
+		return fmt.Sprintf("substr(%s, %s)", str, start)
+	}
+	return fmt.Sprintf("substr(%s, %s, %s)", str, start, length)
+}
+
+// Position implements the Dialect interface.
+func (SQLiteDialect) Position(str, substr string) string {
+	return fmt.Sprintf("instr(%s, %s)", str, substr)
+}
+
+// Truncate implements the Dialect interface. Casting reals to integers
+// truncates them.
+func (SQLiteDialect) Truncate(number string) string {
+	return fmt.Sprintf("CAST(%s AS INTEGER)", number)
+}
+
+// Extract implements the Dialect interface.
+func (SQLiteDialect) Extract(part DatePart, timestamp string) string {
+	if part == Millisecond {
+		// %f yields the seconds along with the milliseconds (SS.SSS).
+		return fmt.Sprintf("CAST(substr(strftime('%%f', %s), 4) AS INTEGER)", timestamp)
+	}
+	format := map[DatePart]string{
+		Year:      "%Y",
+		Month:     "%m",
+		Day:       "%d",
+		DayOfWeek: "%w",
+		DayOfYear: "%j",
+		Hour:      "%H",
+		Minute:    "%M",
+		Second:    "%S",
+	}[part]
+	return fmt.Sprintf("CAST(strftime('%s', %s) AS INTEGER)", format, timestamp)
+}
+
+// AtTimeZone implements the Dialect interface. It requires a user function
+// named at_time_zone to be registered in the connection (see
+// SQLiteAtTimeZone).
+func (SQLiteDialect) AtTimeZone(timestamp, zone string, value ValueFunc) string {
+	return fmt.Sprintf("at_time_zone(%s, %s)", timestamp, value(zone))
+}
+
+// Now implements the Dialect interface.
+func (SQLiteDialect) Now() string {
+	return "strftime('%Y-%m-%d %H:%M:%f', 'now')"
+}
+
+// AddDuration implements the Dialect interface.
+func (SQLiteDialect) AddDuration(timestamp string, duration time.Duration, value ValueFunc) string {
+	modifier := formatSeconds(duration) + " seconds"
+	if duration >= 0 {
+		modifier = "+" + modifier
+	}
+	return fmt.Sprintf("strftime('%%Y-%%m-%%d %%H:%%M:%%f', %s, %s)", timestamp, value(modifier))
+}
+
+// Interval implements the Dialect interface. Durations are represented as
+// numbers of seconds.
+func (SQLiteDialect) Interval(duration time.Duration, value ValueFunc) string {
+	return value(seconds(duration))
+}
+
+// TimestampDiff implements the Dialect interface. The difference of the Julian
+// days is rounded to milliseconds, which is the precision of the timestamps,
+// to get rid of floating point errors.
+func (SQLiteDialect) TimestampDiff(end, start string) string {
+	return fmt.Sprintf("ROUND((julianday(%s) - julianday(%s)) * 86400, 3)", end, start)
+}
+
+// Cast implements the Dialect interface. JSON booleans are already extracted
+// as integers, which is how SQLite represents booleans. Durations require the
+// duration_seconds user function to be registered in the connection (see
+// SQLiteDurationSeconds).
+func (SQLiteDialect) Cast(expr string, to SQLType) string {
+	switch to {
+	case TimestampType:
+		// Normalizes timestamps to UTC so they can be compared as strings.
+		return fmt.Sprintf("strftime('%%Y-%%m-%%d %%H:%%M:%%f', %s)", expr)
+
+	case IntType:
+		return fmt.Sprintf("CAST(%s AS INTEGER)", expr)
+
+	case DoubleType:
+		return fmt.Sprintf("CAST(%s AS REAL)", expr)
+
+	case DurationType:
+		return fmt.Sprintf("duration_seconds(%s)", expr)
+
+	case StringType:
+		return fmt.Sprintf("CAST(%s AS TEXT)", expr)
+	}
+	return expr
+}
+
+// SQLiteRegexp implements the regexp user function that backs the REGEXP
+// operator in SQLite. Since it relies on the same regular expression engine as
+// CEL, patterns have the same semantics as in the matches function. It must be
+// registered in the connection with the driver's facilities. Values other than
+// text, such as the numbers extracted from JSON documents, are matched against
+// their text representation, and missing values yield NULL.
+func SQLiteRegexp(pattern string, value any) (any, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+
+	case string:
+		return regexp.MatchString(pattern, v)
+	}
+	return regexp.MatchString(pattern, fmt.Sprint(value))
+}
+
+// sqliteTimestampLayout is the layout of the timestamps yielded by the
+// conversions of the SQLite dialect.
+const sqliteTimestampLayout = "2006-01-02 15:04:05.000"
+
+// SQLiteAtTimeZone implements the at_time_zone user function, which converts a
+// timestamp to the local time of a time zone in SQLite. The zone is either an
+// IANA time zone name or a UTC offset, such as -03:00. It must be registered in
+// the connection with the driver's facilities.
+func SQLiteAtTimeZone(timestamp, zone string) (string, error) {
+	location, err := loadLocation(zone)
+	if err != nil {
+		return "", err
+	}
+	t, err := time.Parse(sqliteTimestampLayout, timestamp)
+	if err != nil {
+		if t, err = time.Parse(time.RFC3339Nano, timestamp); err != nil {
+			return "", err
+		}
+	}
+	return t.In(location).Format(sqliteTimestampLayout), nil
+}
+
+// SQLiteDurationSeconds implements the duration_seconds user function, which
+// converts a duration in the format accepted by CEL, such as 1h30m, into a
+// number of seconds in SQLite. It must be registered in the connection with the
+// driver's facilities. Missing values, such as absent JSON keys, yield NULL.
+func SQLiteDurationSeconds(duration any) (any, error) {
+	if duration == nil {
+		return nil, nil
+	}
+	str, ok := duration.(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid duration %v", duration)
+	}
+	d, err := time.ParseDuration(str)
+	if err != nil {
+		return nil, err
+	}
+	return d.Seconds(), nil
+}
@@ -0,0 +1,651 @@
+package cel2sql
+
+import (
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"cel2sql/cel"
+
+	celgo "github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/go-cmp/cmp"
+	"github.com/mattn/go-sqlite3"
+)
+
+func init() {
+	sql.Register("sqlite3_cel2sql", &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			if err := conn.RegisterFunc("regexp", SQLiteRegexp, true); err != nil {
+				return err
+			}
+			if err := conn.RegisterFunc("at_time_zone", SQLiteAtTimeZone, true); err != nil {
+				return err
+			}
+			return conn.RegisterFunc("duration_seconds", SQLiteDurationSeconds, true)
+		},
+	})
+}
+
+// openSQLite returns an in-memory SQLite database with the provided schema
+// and rows.
+func openSQLite(t *testing.T, statements ...string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3_cel2sql", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each connection to an in-memory database gets its own database.
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	for _, statement := range statements {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+// selectNames converts the filter with the SQLite dialect and returns the names
+// of the rows of the table that match it.
+func selectNames(t *testing.T, db *sql.DB, env *celgo.Env, table, filter string) []string {
+	t.Helper()
+	where, vars, err := ConvertWithVars(env, filter, WithDialect(SQLiteDialect{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.Query("SELECT name FROM "+table+" WHERE "+where+" ORDER BY name", vars...)
+	if err != nil {
+		t.Fatalf("Error running %q: %v", where, err)
+	}
+	defer rows.Close()
+
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+func TestSQLiteRecordExpressions(t *testing.T) {
+	db := openSQLite(t,
+		`CREATE TABLE records (name TEXT, type TEXT, data TEXT)`,
+		`INSERT INTO records VALUES ('foo', 'tekton.dev/v1beta1.PipelineRun', '{
+			"metadata": {"name": "foo-run", "namespace": "default", "labels": {"app": "foo"}, "annotations": {"attempt": "2", "skip": "true"}},
+			"spec": {"params": [{"name": "a", "value": "1"}, {"name": "b", "value": "2"}], "workspaces": ["source"], "retries": 3, "ratio": 0.5, "enabled": true, "timeout": "1h30m"},
+			"status": {"completionTime": "2022-10-30T21:45:00Z", "conditions": [{"type": "Succeeded", "status": "False", "reason": "Failed"}]}
+		}')`,
+		`INSERT INTO records VALUES ('bar', 'tekton.dev/v1beta1.TaskRun', '{
+			"metadata": {"name": "bar-run", "namespace": "ci", "annotations": {"attempt": "first", "skip": "False"}},
+			"spec": {"params": [], "retries": 1, "ratio": 1.5, "enabled": false, "timeout": "45m0s"},
+			"status": {"startTime": null, "completionTime": "2023-01-16T10:00:30.250Z", "conditions": [{"type": "Succeeded", "status": "True", "reason": null}]}
+		}')`,
+	)
+
+	tests := []struct {
+		name string
+		in   string
+		want []string
+	}{{
+		name: "simple expression",
+		in:   `name == "foo"`,
+		want: []string{"foo"},
+	},
+		{
+			name: "select expression",
+			in:   `data.metadata.namespace == "default"`,
+			want: []string{"foo"},
+		},
+		{
+			name: "JSON containment with numbers",
+			in:   `data.spec.retries == 3 || data.spec.ratio == 1.5`,
+			want: []string{"bar", "foo"},
+		},
+		{
+			name: "JSON containment with booleans",
+			in:   `data.spec.enabled == false`,
+			want: []string{"bar"},
+		},
+		{
+			name: "merged JSON containment checks",
+			in:   `data.metadata.namespace == "default" && data.metadata.labels["app"] == "foo" && data.spec.retries == 3`,
+			want: []string{"foo"},
+		},
+		{
+			name: "in operator",
+			in:   `data.metadata.namespace in ["ci", "prod"]`,
+			want: []string{"bar"},
+		},
+		{
+			name: "in operator with a JSON array",
+			in:   `"source" in data.spec.workspaces`,
+			want: []string{"foo"},
+		},
+		{
+			name: "index operator",
+			in:   `data.metadata.labels["app"] == "foo"`,
+			want: []string{"foo"},
+		},
+		{
+			name: "index operator on a JSON array",
+			in:   `data.spec.params[1].value == "2"`,
+			want: []string{"foo"},
+		},
+		{
+			name: "has macro on a JSON array element",
+			in:   `has(data.spec.params[1].value)`,
+			want: []string{"foo"},
+		},
+		{
+			name: "contains string function",
+			in:   `data.metadata.name.contains("bar")`,
+			want: []string{"bar"},
+		},
+		{
+			name: "startsWith string function",
+			in:   `data.metadata.name.startsWith("foo")`,
+			want: []string{"foo"},
+		},
+		{
+			name: "startsWith string function is case sensitive",
+			in:   `data.metadata.name.startsWith("FOO")`,
+			want: []string{},
+		},
+		{
+			name: "endsWith string function",
+			in:   `data.metadata.name.endsWith("-run")`,
+			want: []string{"bar", "foo"},
+		},
+		{
+			name: "matches function",
+			in:   `data.metadata.name.matches("^b.*-run$")`,
+			want: []string{"bar"},
+		},
+		{
+			name: "case-insensitive matches function",
+			in:   `data.metadata.name.matches("(?i)^FOO-")`,
+			want: []string{"foo"},
+		},
+		{
+			name: "startsWith string function with LIKE wildcards",
+			in:   `data.metadata.name.startsWith("f_o")`,
+			want: []string{},
+		},
+		{
+			name: "type coercion",
+			in:   `data.status.completionTime > timestamp("2023-01-01T00:00:00Z")`,
+			want: []string{"bar"},
+		},
+		{
+			name: "type coercion to integers",
+			in:   `data.spec.retries > 2`,
+			want: []string{"foo"},
+		},
+		{
+			name: "type coercion to doubles",
+			in:   `1.0 < data.spec.ratio`,
+			want: []string{"bar"},
+		},
+		{
+			name: "type coercion to booleans",
+			in:   `data.spec.enabled == true`,
+			want: []string{"foo"},
+		},
+		{
+			name: "type coercion to durations",
+			in:   `data.spec.timeout < duration("1h")`,
+			want: []string{"bar"},
+		},
+		{
+			name: "type coercion in the in operator",
+			in:   `data.spec.retries in [1, 2]`,
+			want: []string{"bar"},
+		},
+		{
+			name: "type coercion of function arguments",
+			in:   `name.substring(data.spec.retries) == "ar"`,
+			want: []string{"bar"},
+		},
+		{
+			name: "int conversion function",
+			in:   `int(data.metadata.annotations["attempt"]) >= 2`,
+			want: []string{"foo"},
+		},
+		{
+			name: "int conversion function on a double",
+			in:   `int(data.spec.ratio * 1.5) == 2`,
+			want: []string{"bar"},
+		},
+		{
+			name: "double conversion function",
+			in:   `double(data.spec.retries) / 2.0 == 1.5`,
+			want: []string{"foo"},
+		},
+		{
+			name: "string conversion function",
+			in:   `string(data.spec.retries) == "1"`,
+			want: []string{"bar"},
+		},
+		{
+			name: "bool conversion function",
+			in:   `!bool(data.metadata.annotations["skip"])`,
+			want: []string{"bar"},
+		},
+		{
+			name: "duration conversion function",
+			in:   `duration(data.spec.timeout) > duration("1h")`,
+			want: []string{"foo"},
+		},
+		{
+			name: "relative time filter",
+			in:   `data.status.completionTime > now() - duration("876000h")`,
+			want: []string{"bar", "foo"},
+		},
+		{
+			name: "timestamp arithmetic",
+			in:   `data.status.completionTime + duration("24h") > timestamp("2022-10-31T21:00:00Z")`,
+			want: []string{"bar", "foo"},
+		},
+		{
+			name: "timestamp arithmetic with fractional seconds",
+			in:   `data.status.completionTime - duration("1.5s") < timestamp("2022-10-30T21:44:59Z")`,
+			want: []string{"foo"},
+		},
+		{
+			name: "getFullYear function",
+			in:   `data.status.completionTime.getFullYear() == 2022`,
+			want: []string{"foo"},
+		},
+		{
+			name: "getDayOfMonth function",
+			in:   `data.status.completionTime.getDayOfMonth() == 29`,
+			want: []string{"foo"},
+		},
+		{
+			name: "getDayOfWeek function",
+			in:   `data.status.completionTime.getDayOfWeek() == 0`,
+			want: []string{"foo"},
+		},
+		{
+			name: "getDayOfYear function",
+			in:   `data.status.completionTime.getDayOfYear() == 302`,
+			want: []string{"foo"},
+		},
+		{
+			name: "getMonth function",
+			in:   `data.status.completionTime.getMonth() == 0`,
+			want: []string{"bar"},
+		},
+		{
+			name: "getHours function with a time zone",
+			in:   `data.status.completionTime.getHours("America/Sao_Paulo") == 18`,
+			want: []string{"foo"},
+		},
+		{
+			name: "getDate function with a UTC offset",
+			in:   `data.status.completionTime.getDate("+03:00") == 31`,
+			want: []string{"foo"},
+		},
+		{
+			name: "getMinutes function",
+			in:   `data.status.completionTime.getMinutes() == 45`,
+			want: []string{"foo"},
+		},
+		{
+			name: "getSeconds function",
+			in:   `data.status.completionTime.getSeconds() == 30`,
+			want: []string{"bar"},
+		},
+		{
+			name: "getMilliseconds function",
+			in:   `data.status.completionTime.getMilliseconds() == 250`,
+			want: []string{"bar"},
+		},
+		{
+			name: "lowerAscii function",
+			in:   `data.metadata.namespace.upperAscii().lowerAscii() == "default"`,
+			want: []string{"foo"},
+		},
+		{
+			name: "trim function",
+			in:   `name.replace("b", "\t ").trim() == "ar"`,
+			want: []string{"bar"},
+		},
+		{
+			name: "replace function",
+			in:   `data.metadata.name.replace("-", "_") == "foo_run"`,
+			want: []string{"foo"},
+		},
+		{
+			name: "substring function",
+			in:   `data.metadata.name.substring(1, 3) == "ar"`,
+			want: []string{"bar"},
+		},
+		{
+			name: "indexOf function",
+			in:   `data.metadata.name.indexOf("-run") == 3`,
+			want: []string{"bar", "foo"},
+		},
+		{
+			name: "indexOf function with a start index",
+			in:   `data.metadata.name.indexOf("o", 2) == 2`,
+			want: []string{"foo"},
+		},
+		{
+			name: "indexOf function without occurrences",
+			in:   `data.metadata.name.indexOf("o", 2) == -1`,
+			want: []string{"bar"},
+		},
+		{
+			name: "data_type field",
+			in:   `data_type == PIPELINE_RUN`,
+			want: []string{"foo"},
+		},
+		{
+			name: "conditional expression",
+			in:   `(data_type == PIPELINE_RUN ? data.metadata.namespace : data.metadata.name) == "bar-run"`,
+			want: []string{"bar"},
+		},
+		{
+			name: "exists macro",
+			in:   `data.status.conditions.exists(c, c.type == "Succeeded" && c.status == "False")`,
+			want: []string{"foo"},
+		},
+		{
+			name: "all macro",
+			in:   `data.status.conditions.all(c, c.status == "True")`,
+			want: []string{"bar"},
+		},
+		{
+			name: "exists_one macro",
+			in:   `data.spec.params.exists_one(p, p.name == "a")`,
+			want: []string{"foo"},
+		},
+		{
+			name: "iteration variables named after SQL keywords",
+			in:   `data.status.conditions.all(order, order.status == "True")`,
+			want: []string{"bar"},
+		},
+		{
+			name: "has macro",
+			in:   `has(data.metadata.labels)`,
+			want: []string{"foo"},
+		},
+		{
+			name: "comparison with an explicit JSON null",
+			in:   `data.status.startTime == null`,
+			want: []string{"bar"},
+		},
+		{
+			name: "missing keys don't differ from null",
+			in:   `data.status.startTime != null`,
+			want: []string{},
+		},
+		{
+			name: "inequality with null",
+			in:   `null != data.status.completionTime`,
+			want: []string{"bar", "foo"},
+		},
+		{
+			name: "comparison of iteration variables with null",
+			in:   `data.status.conditions.exists(c, c.reason == null)`,
+			want: []string{"bar"},
+		},
+		{
+			name: "difference of timestamps",
+			in:   `data.status.completionTime - timestamp("2022-10-30T21:00:00Z") < duration("1h")`,
+			want: []string{"foo"},
+		},
+		{
+			name: "exact difference of timestamps",
+			in:   `data.status.completionTime - timestamp("2023-01-16T09:59:59Z") == duration("31.25s")`,
+			want: []string{"bar"},
+		},
+		{
+			name: "scalars don't match the elements of JSON arrays",
+			in:   `data.spec.workspaces == "source"`,
+			want: []string{},
+		},
+		{
+			name: "negated dyn values",
+			in:   `!data.spec.enabled`,
+			want: []string{"bar"},
+		},
+		{
+			name: "dyn operands of logical operators",
+			in:   `data.spec.enabled || name == "bar"`,
+			want: []string{"bar", "foo"},
+		},
+		{
+			name: "dyn conditions",
+			in:   `(data.spec.enabled ? data.spec.retries : 0) == 3`,
+			want: []string{"foo"},
+		},
+		{
+			name: "size function on a JSON array",
+			in:   `size(data.spec.params) > 1`,
+			want: []string{"foo"},
+		},
+		{
+			name: "size function on a JSON object",
+			in:   `size(data.metadata) == 3`,
+			want: []string{"bar"},
+		},
+	}
+
+	env, err := cel.NewRecordsEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := selectNames(t, db, env, "records", test.in)
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("Mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSQLiteResultExpressions(t *testing.T) {
+	db := openSQLite(t,
+		`CREATE TABLE results (name TEXT, annotations TEXT, recordsummary_record TEXT, recordsummary_type TEXT, recordsummary_status INTEGER, recordsummary_end_time TEXT, recordsummary_annotations TEXT)`,
+		`INSERT INTO results VALUES ('foo', '{"repo": "tektoncd/results", "commit": "abc"}', 'foo/results/foo/records/foo', 'tekton.dev/v1beta1.PipelineRun', 1, '2022-10-30 21:45:00', '{"branch": "main", "actor": "john-doe"}')`,
+		`INSERT INTO results VALUES ('bar', '{"repo": "tektoncd/pipeline"}', 'foo/results/bar/records/bar', 'tekton.dev/v1beta1.TaskRun', 2, NULL, '{}')`,
+	)
+
+	tests := []struct {
+		name string
+		in   string
+		want []string
+	}{{
+		name: "Result.Annotations field",
+		in:   `annotations["repo"] == "tektoncd/results"`,
+		want: []string{"foo"},
+	},
+		{
+			name: "other operators involving the Result.Annotations field",
+			in:   `annotations["repo"].endsWith("pipeline")`,
+			want: []string{"bar"},
+		},
+		{
+			name: "Result.Summary.Annotations field",
+			in:   `summary.annotations["actor"] == "john-doe" && summary.annotations["branch"] == "main"`,
+			want: []string{"foo"},
+		},
+		{
+			name: "RecordSummary_Status constants",
+			in:   `summary.status == SUCCESS`,
+			want: []string{"foo"},
+		},
+		{
+			name: "comparison with the TASK_RUN const value",
+			in:   `summary.type == TASK_RUN`,
+			want: []string{"bar"},
+		},
+		{
+			name: "has macro on a RecordSummary field",
+			in:   `has(summary.end_time)`,
+			want: []string{"foo"},
+		},
+		{
+			name: "has macro on the Result.Summary.Annotations field",
+			in:   `!has(summary.annotations.branch)`,
+			want: []string{"bar"},
+		},
+		{
+			name: "comparison with null",
+			in:   `summary.end_time == null`,
+			want: []string{"bar"},
+		},
+		{
+			name: "inequality with null",
+			in:   `summary.end_time != null`,
+			want: []string{"foo"},
+		},
+		{
+			name: "size function on a map field",
+			in:   `size(annotations) == 2`,
+			want: []string{"foo"},
+		},
+	}
+
+	env, err := cel.NewResultsEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := selectNames(t, db, env, "results", test.in)
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("Mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// TestSQLiteOperatorPrecedence generates random boolean and arithmetic
+// expressions whose grouping is spelled out with parentheses, and checks that
+// the rows matched by the generated SQL are the ones matched by evaluating the
+// CEL expression. Any operand regrouped by the SQL precedence rules would make
+// them diverge.
+func TestSQLiteOperatorPrecedence(t *testing.T) {
+	env, err := celgo.NewEnv(celgo.Declarations(
+		decls.NewVar("x", decls.Int),
+		decls.NewVar("y", decls.Int),
+		decls.NewVar("z", decls.Int),
+		decls.NewVar("p", decls.Bool),
+		decls.NewVar("q", decls.Bool),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type row struct {
+		name    string
+		x, y, z int64
+		p, q    bool
+	}
+	rows := []row{
+		{"a", 0, 0, 0, false, false},
+		{"b", 1, -2, 3, true, false},
+		{"c", -3, 2, -1, false, true},
+		{"d", 2, 2, 2, true, true},
+		{"e", 3, -1, 0, true, false},
+	}
+	statements := []string{"CREATE TABLE vars (name TEXT, x INTEGER, y INTEGER, z INTEGER, p BOOLEAN, q BOOLEAN)"}
+	for _, r := range rows {
+		statements = append(statements, fmt.Sprintf("INSERT INTO vars VALUES ('%s', %d, %d, %d, %t, %t)", r.name, r.x, r.y, r.z, r.p, r.q))
+	}
+	db := openSQLite(t, statements...)
+
+	random := rand.New(rand.NewSource(1))
+	for n := 0; n < 500; n++ {
+		filter := randomBoolExpr(random, 4)
+
+		ast, issues := env.Compile(filter)
+		if issues != nil && issues.Err() != nil {
+			t.Fatalf("Error compiling %q: %v", filter, issues.Err())
+		}
+		program, err := env.Program(ast)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{}
+		for _, r := range rows {
+			out, _, err := program.Eval(map[string]any{"x": r.x, "y": r.y, "z": r.z, "p": r.p, "q": r.q})
+			if err != nil {
+				t.Fatalf("Error evaluating %q: %v", filter, err)
+			}
+			if out.Value() == true {
+				want = append(want, r.name)
+			}
+		}
+
+		if diff := cmp.Diff(want, selectNames(t, db, env, "vars", filter)); diff != "" {
+			t.Errorf("Mismatch for %q (-want +got):\n%s", filter, diff)
+		}
+	}
+}
+
+// randomBoolExpr returns a random boolean CEL expression of the provided
+// depth at most, whose compound operands are all parenthesized.
+func randomBoolExpr(random *rand.Rand, depth int) string {
+	if depth == 0 {
+		return []string{"p", "q", "true", "false"}[random.Intn(4)]
+	}
+	depth--
+	switch random.Intn(7) {
+	case 0:
+		return fmt.Sprintf("(%s && %s)", randomBoolExpr(random, depth), randomBoolExpr(random, depth))
+	case 1:
+		return fmt.Sprintf("(%s || %s)", randomBoolExpr(random, depth), randomBoolExpr(random, depth))
+	case 2:
+		return fmt.Sprintf("!(%s)", randomBoolExpr(random, depth))
+	case 3:
+		op := []string{"==", "!="}[random.Intn(2)]
+		return fmt.Sprintf("(%s %s %s)", randomBoolExpr(random, depth), op, randomBoolExpr(random, depth))
+	case 4:
+		return fmt.Sprintf("(%s ? %s : %s)", randomBoolExpr(random, depth), randomBoolExpr(random, depth), randomBoolExpr(random, depth))
+	default:
+		op := []string{"==", "!=", "<", "<=", ">", ">="}[random.Intn(6)]
+		return fmt.Sprintf("(%s %s %s)", randomIntExpr(random, depth), op, randomIntExpr(random, depth))
+	}
+}
+
+// randomIntExpr returns a random integer CEL expression of the provided depth
+// at most, whose compound operands are all parenthesized. Operands are small
+// enough for the expression not to overflow.
+func randomIntExpr(random *rand.Rand, depth int) string {
+	if depth == 0 || random.Intn(4) == 0 {
+		if random.Intn(2) == 0 {
+			return []string{"x", "y", "z"}[random.Intn(3)]
+		}
+		return strconv.Itoa(random.Intn(7) - 3)
+	}
+	depth--
+	switch random.Intn(5) {
+	case 0:
+		return fmt.Sprintf("-(%s)", randomIntExpr(random, depth))
+	case 1:
+		return fmt.Sprintf("(%s ? %s : %s)", randomBoolExpr(random, depth), randomIntExpr(random, depth), randomIntExpr(random, depth))
+	default:
+		op := []string{"+", "-", "*"}[random.Intn(3)]
+		return fmt.Sprintf("(%s %s %s)", randomIntExpr(random, depth), op, randomIntExpr(random, depth))
+	}
+}
@@ -0,0 +1,149 @@
+package cel2sql
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/google/cel-go/checker/decls"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// Functions of the cel-go strings extension (see ext.Strings). All indices are
+// zero-based in CEL, whereas they're one-based in SQL.
+const (
+	indexOfFunction    = "indexOf"
+	lowerASCIIFunction = "lowerAscii"
+	replaceFunction    = "replace"
+	splitFunction      = "split"
+	substringFunction  = "substring"
+	trimFunction       = "trim"
+	upperASCIIFunction = "upperAscii"
+)
+
+// interpretReplaceFunction translates the replace function. The optional limit
+// on the number of replacements isn't supported.
+func (i *interpreter) interpretReplaceFunction(id int64, expr *exprpb.Expr_CallExpr) (sqlExpr, error) {
+	if _, args := targetAndArgs(expr); len(args) > 2 {
+		return nil, i.unsupportedExprError(id, "`replace` function with a limit")
+	}
+	return i.translateIntoCall(expr, replaceFunc)
+}
+
+// interpretSubstringFunction translates the substring function, whose range is
+// made up of the zero-based start (inclusive) and end (exclusive) indices, into
+// a SQL substring given by its one-based start position and its length.
+func (i *interpreter) interpretSubstringFunction(expr *exprpb.Expr_CallExpr) (sqlExpr, error) {
+	target, args := targetAndArgs(expr)
+	str, err := i.interpretExpr(target)
+	if err != nil {
+		return nil, err
+	}
+	start, err := i.interpretCoercedArg(args[0], decls.Int)
+	if err != nil {
+		return nil, err
+	}
+
+	call := call{substringFunc, []sqlExpr{str, addInt(start, 1)}}
+	if len(args) > 1 {
+		end, err := i.interpretCoercedArg(args[1], decls.Int)
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, subtract(end, start))
+	}
+	return call, nil
+}
+
+// interpretIndexOfFunction translates the indexOf function, which returns -1
+// if the substring isn't found. Its optional argument is the index the search
+// starts at, so the search is done in the rest of the string and the position
+// is then shifted.
+func (i *interpreter) interpretIndexOfFunction(expr *exprpb.Expr_CallExpr) (sqlExpr, error) {
+	target, args := targetAndArgs(expr)
+	str, err := i.interpretExpr(target)
+	if err != nil {
+		return nil, err
+	}
+	substr, err := i.interpretExpr(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if len(args) == 1 {
+		return addInt(call{positionFunc, []sqlExpr{str, substr}}, -1), nil
+	}
+
+	offset, err := i.interpretCoercedArg(args[1], decls.Int)
+	if err != nil {
+		return nil, err
+	}
+	rest := call{substringFunc, []sqlExpr{str, addInt(offset, 1)}}
+	position := call{positionFunc, []sqlExpr{rest, substr}}
+
+	var index sqlExpr = paren{binaryExpr{"-", binaryExpr{"+", position, offset}, raw{"1"}}}
+	if value, ok := intLiteral(offset); ok {
+		index = addInt(position, value-1)
+	}
+	return caseExpr{binaryExpr{"=", position, raw{"0"}}, raw{"-1"}, index}, nil
+}
+
+// interpretASCIICaseFunction translates the lowerAscii and upperAscii
+// functions, as long as the dialect can change the case of ASCII letters only.
+// The SQL functions that change the case of all letters, such as LOWER in
+// MySQL, would change the non-ASCII ones too.
+func (i *interpreter) interpretASCIICaseFunction(id int64, expr *exprpb.Expr_CallExpr, function function) (sqlExpr, error) {
+	if _, ok := i.dialect.(ASCIICaseDialect); !ok {
+		name := fmt.Sprintf("`%s` function", expr.CallExpr.GetFunction())
+		return nil, fmt.Errorf("%w: the SQL dialect can't change the case of ASCII letters only", i.unsupportedExprError(id, name))
+	}
+	return i.translateIntoCall(expr, function)
+}
+
+// interpretSplitFunction translates the split function into a SQL array, as
+// long as the dialect supports them. The optional limit on the number of
+// substrings isn't supported.
+func (i *interpreter) interpretSplitFunction(id int64, expr *exprpb.Expr_CallExpr) (sqlExpr, error) {
+	if _, ok := i.dialect.(ArrayDialect); !ok {
+		return nil, fmt.Errorf("%w: the SQL dialect doesn't support arrays", i.unsupportedExprError(id, "`split` function"))
+	}
+	if _, args := targetAndArgs(expr); len(args) > 1 {
+		return nil, i.unsupportedExprError(id, "`split` function with a limit")
+	}
+	return i.translateIntoCall(expr, splitFunc)
+}
+
+// intLiteral returns the value of the provided SQL expression if it's an
+// integer literal.
+func intLiteral(expr sqlExpr) (int64, bool) {
+	if literal, ok := expr.(literal); ok {
+		value, ok := literal.value.(int64)
+		return value, ok
+	}
+	return 0, false
+}
+
+// addInt returns an expression that adds n to the provided integer expression.
+// Literals are computed right away.
+func addInt(expr sqlExpr, n int64) sqlExpr {
+	if value, ok := intLiteral(expr); ok {
+		return literal{value + n}
+	}
+	switch {
+	case n > 0:
+		return paren{binaryExpr{"+", expr, raw{strconv.FormatInt(n, 10)}}}
+
+	case n < 0:
+		return paren{binaryExpr{"-", expr, raw{strconv.FormatInt(-n, 10)}}}
+	}
+	return expr
+}
+
+// subtract returns an expression that subtracts the provided integer
+// expressions. Literals are computed right away.
+func subtract(minuend, subtrahend sqlExpr) sqlExpr {
+	if value, ok := intLiteral(subtrahend); ok {
+		return addInt(minuend, -value)
+	}
+	return paren{binaryExpr{"-", minuend, subtrahend}}
+}
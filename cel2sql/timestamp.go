@@ -0,0 +1,112 @@
+package cel2sql
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/google/cel-go/common/operators"
+	"github.com/google/cel-go/common/overloads"
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// interpretNowFunction translates the now() function into the instant fixed by
+// the WithNow option or, by default, into the current time of the database.
+func (i *interpreter) interpretNowFunction() (sqlExpr, error) {
+	i.callsNow = true
+	if i.now.IsZero() {
+		return currentTimestamp{}, nil
+	}
+	return cast{literal{i.now.UTC().Format(time.RFC3339Nano)}, TimestampType}, nil
+}
+
+// interpretTimestampArithmeticExpr translates the addition of a duration to a
+// timestamp, or its subtraction from a timestamp. Dyn operands are coerced to
+// timestamps. Only constant durations are supported, since they're translated
+// into SQL intervals.
+func (i *interpreter) interpretTimestampArithmeticExpr(function string, timestampExpr, durationExpr *exprpb.Expr) (sqlExpr, error) {
+	duration, err := i.durationOf(durationExpr)
+	if err != nil {
+		return nil, err
+	}
+	if function == operators.Subtract {
+		duration = -duration
+	}
+
+	timestamp, err := i.interpretExpr(timestampExpr)
+	if err != nil {
+		return nil, err
+	}
+	if i.isDyn(timestampExpr) {
+		timestamp = coerceWellKnownType(timestamp, exprpb.Type_TIMESTAMP)
+	}
+	return addDuration{timestamp, duration}, nil
+}
+
+// interpretTimestampDiffExpr translates the subtraction of a timestamp from
+// another, which yields the duration elapsed between them. Dyn operands are
+// coerced to timestamps.
+func (i *interpreter) interpretTimestampDiffExpr(endExpr, startExpr *exprpb.Expr) (sqlExpr, error) {
+	end, err := i.interpretExpr(endExpr)
+	if err != nil {
+		return nil, err
+	}
+	if i.isDyn(endExpr) {
+		end = coerceWellKnownType(end, exprpb.Type_TIMESTAMP)
+	}
+	start, err := i.interpretExpr(startExpr)
+	if err != nil {
+		return nil, err
+	}
+	if i.isDyn(startExpr) {
+		start = coerceWellKnownType(start, exprpb.Type_TIMESTAMP)
+	}
+	return timestampDiff{end, start}, nil
+}
+
+// durationOf returns the value of a constant duration, such as
+// `duration("24h")`.
+func (i *interpreter) durationOf(expr *exprpb.Expr) (time.Duration, error) {
+	if constant := expr.GetConstExpr(); constant != nil && constant.GetDurationValue() != nil {
+		return constant.GetDurationValue().AsDuration(), nil
+	}
+
+	call := expr.GetCallExpr()
+	if call.GetFunction() == overloads.TypeConvertDuration && len(call.GetArgs()) == 1 {
+		if arg := call.GetArgs()[0].GetConstExpr(); arg != nil {
+			if _, ok := arg.GetConstantKind().(*exprpb.Constant_StringValue); ok {
+				duration, err := time.ParseDuration(arg.GetStringValue())
+				if err != nil {
+					return 0, fmt.Errorf("%w: %v", i.unsupportedExprError(expr.GetId(), "duration"), err)
+				}
+				return duration, nil
+			}
+		}
+	}
+	return 0, i.unsupportedExprError(expr.GetId(), "non-constant duration")
+}
+
+// utcOffsetPattern matches the UTC offsets accepted as time zones by CEL.
+var utcOffsetPattern = regexp.MustCompile(`^[+-](0[0-9]|1[0-4]):[0-5][0-9]$`)
+
+// isUTCOffset returns true if the provided time zone is a UTC offset, such as
+// -03:00, rather than an IANA time zone name.
+func isUTCOffset(zone string) bool {
+	return utcOffsetPattern.MatchString(zone)
+}
+
+// loadLocation returns the location of the provided time zone, with the same
+// semantics as the time zone arguments of the CEL timestamp accessors.
+func loadLocation(zone string) (*time.Location, error) {
+	if !isUTCOffset(zone) {
+		return time.LoadLocation(zone)
+	}
+	hours, _ := strconv.Atoi(zone[1:3])
+	minutes, _ := strconv.Atoi(zone[4:])
+	offset := hours*60*60 + minutes*60
+	if zone[0] == '-' {
+		offset = -offset
+	}
+	return time.FixedZone(zone, offset), nil
+}
@@ -1,34 +1,105 @@
 package cel2sql
 
 import (
+	"github.com/google/cel-go/common/operators"
 	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
 )
 
 // isDyn returns true if the provided expression is a CEL dyn type or false
-// otherwise.
+// otherwise. Values of the google.protobuf.Any type, such as the data field,
+// are treated as dyn, and so are the fields and elements of dyn values, even if
+// the type checker narrowed them down to the type expected by the function
+// they're passed to, as it does with the arguments of conversion functions.
 func (i *interpreter) isDyn(expr *exprpb.Expr) bool {
 	if theType, found := i.checkedExpr.TypeMap[expr.GetId()]; found {
 		if _, ok := theType.GetTypeKind().(*exprpb.Type_Dyn); ok {
 			return true
 		}
+		if theType.GetWellKnown() == exprpb.Type_ANY {
+			return true
+		}
+	}
+	if operand := expr.GetSelectExpr().GetOperand(); operand != nil {
+		// The has() macro yields a boolean.
+		return !expr.GetSelectExpr().GetTestOnly() && i.isDyn(operand)
+	}
+	if call := expr.GetCallExpr(); call.GetFunction() == operators.Index {
+		return i.isDyn(call.GetArgs()[0])
 	}
 	return false
 }
 
-func (i *interpreter) isRecordSummary(expr *exprpb.Expr) bool {
+// isMap returns true if the provided expression is a CEL map type or false
+// otherwise.
+func (i *interpreter) isMap(expr *exprpb.Expr) bool {
 	if theType, found := i.checkedExpr.TypeMap[expr.GetId()]; found {
-		if messageType := theType.GetMessageType(); messageType == "tekton.results.v1alpha2.RecordSummary" {
-			return true
-		}
+		return theType.GetMapType() != nil
+	}
+	return false
+}
+
+// isString returns true if the provided expression is a CEL string type or
+// false otherwise.
+func (i *interpreter) isString(expr *exprpb.Expr) bool {
+	if theType, found := i.checkedExpr.TypeMap[expr.GetId()]; found {
+		return theType.GetPrimitive() == exprpb.Type_STRING
+	}
+	return false
+}
+
+// isArray returns true if the provided expression is a CEL list type yielded by
+// a function, such as split, which is translated into a SQL array. List
+// literals are translated into lists of values instead.
+func (i *interpreter) isArray(expr *exprpb.Expr) bool {
+	if theType, found := i.checkedExpr.TypeMap[expr.GetId()]; found {
+		return theType.GetListType() != nil && expr.GetListExpr() == nil
 	}
 	return false
 }
 
-// coerceToTypeOf writes a Postgres cast directive to the current position of
-// the SQL statement in the buffer, in order to cast the current SQL expression
-// to the SQL type of the provided CEL expression. This feature provides
-// implicit coercion to the supported expressions, by allowing users to compare
-// dyn types to more specific types in a transparent manner.
+// isTimestamp returns true if the provided expression is a CEL timestamp type
+// or false otherwise.
+func (i *interpreter) isTimestamp(expr *exprpb.Expr) bool {
+	if theType, found := i.checkedExpr.TypeMap[expr.GetId()]; found {
+		return theType.GetWellKnown() == exprpb.Type_TIMESTAMP
+	}
+	return false
+}
+
+// isDuration returns true if the provided expression is a CEL duration type or
+// false otherwise.
+func (i *interpreter) isDuration(expr *exprpb.Expr) bool {
+	if theType, found := i.checkedExpr.TypeMap[expr.GetId()]; found {
+		return theType.GetWellKnown() == exprpb.Type_DURATION
+	}
+	return false
+}
+
+// interpretCoercedExpr interprets the provided expression and, if it's a dyn
+// expression, coerces it to the type of the other expression. See
+// coerceToTypeOf.
+func (i *interpreter) interpretCoercedExpr(expr, typeOf *exprpb.Expr) (sqlExpr, error) {
+	sql, err := i.interpretExpr(expr)
+	if err != nil || !i.isDyn(expr) {
+		return sql, err
+	}
+	return i.coerceToTypeOf(sql, typeOf)
+}
+
+// interpretCoercedArg interprets the provided function argument and, if it's a
+// dyn expression, coerces it to the type of the function parameter.
+func (i *interpreter) interpretCoercedArg(expr *exprpb.Expr, paramType *exprpb.Type) (sqlExpr, error) {
+	sql, err := i.interpretExpr(expr)
+	if err != nil || !i.isDyn(expr) {
+		return sql, err
+	}
+	return coerceToType(sql, paramType), nil
+}
+
+// coerceToTypeOf wraps the provided SQL expression into a cast directive, in
+// order to cast it to the SQL type of the provided CEL expression. This feature
+// provides implicit coercion to the supported expressions, by allowing users to
+// compare dyn types to more specific types in a transparent manner.
 //
 // For instance, in the following expression:
 // ```go
@@ -36,24 +107,66 @@ func (i *interpreter) isRecordSummary(expr *exprpb.Expr) bool {
 // ```
 // the data field is a dyn type which maps to a jsonb in the Postgres
 // database. The implicit coercion casts the completionTime to a SQL timestamp
-// in the returned SQL filter.
-func (i *interpreter) coerceToTypeOf(expr *exprpb.Expr) error {
+// in the returned SQL filter. Likewise, dyn values compared to integers,
+// doubles, booleans and durations are cast to the matching SQL types, and dyn
+// values looked up in lists are cast to the type of the list elements.
+func (i *interpreter) coerceToTypeOf(sql sqlExpr, expr *exprpb.Expr) (sqlExpr, error) {
 	if theType, found := i.checkedExpr.TypeMap[expr.GetId()]; found {
-		switch theType.GetTypeKind().(type) {
+		return coerceToType(sql, theType), nil
+	}
+	return nil, ErrUnsupportedExpression
+}
 
-		case *exprpb.Type_WellKnown:
-			i.coerceWellKnownType(theType.GetWellKnown())
+// coerceToType casts the provided SQL expression to the SQL type matching the
+// CEL type. Strings and types without a SQL counterpart are left untouched.
+func coerceToType(sql sqlExpr, theType *exprpb.Type) sqlExpr {
+	switch kind := theType.GetTypeKind().(type) {
+	case *exprpb.Type_WellKnown:
+		return coerceWellKnownType(sql, kind.WellKnown)
+
+	case *exprpb.Type_Primitive:
+		switch kind.Primitive {
+		case exprpb.Type_INT64, exprpb.Type_UINT64:
+			return castTo(sql, IntType)
+
+		case exprpb.Type_DOUBLE:
+			return castTo(sql, DoubleType)
+
+		case exprpb.Type_BOOL:
+			return castTo(sql, BooleanType)
 		}
-		return nil
+
+	case *exprpb.Type_ListType_:
+		return coerceToType(sql, kind.ListType.GetElemType())
 	}
-	return ErrUnsupportedExpression
+	return sql
 }
 
-func (i *interpreter) coerceWellKnownType(wellKnown exprpb.Type_WellKnownType) {
+func coerceWellKnownType(sql sqlExpr, wellKnown exprpb.Type_WellKnownType) sqlExpr {
 	switch wellKnown {
-
 	case exprpb.Type_TIMESTAMP:
-		i.query.WriteString("::TIMESTAMP WITH TIME ZONE")
+		return castTo(sql, TimestampType)
 
+	case exprpb.Type_DURATION:
+		return castTo(sql, DurationType)
+	}
+	return sql
+}
+
+// castTo casts the provided SQL expression to the SQL type, unless it's known
+// to yield a value of that type already. Such is the case of the results of
+// timestamp arithmetic on dyn values, for instance.
+func castTo(sql sqlExpr, to SQLType) sqlExpr {
+	switch node := sql.(type) {
+	case addDuration, currentTimestamp:
+		if to == TimestampType {
+			return sql
+		}
+
+	case cast:
+		if node.to == to {
+			return sql
+		}
 	}
+	return cast{sql, to}
 }
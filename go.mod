@@ -5,8 +5,12 @@ go 1.18
 require (
 	github.com/google/cel-go v0.13.0
 	github.com/google/go-cmp v0.5.9
+	github.com/mattn/go-sqlite3 v2.0.3+incompatible
 	github.com/tektoncd/results v0.4.1-0.20221224012749-cf0eec71fe7c
 	google.golang.org/genproto v0.0.0-20221201204527-e3fa12d562f3
+	google.golang.org/grpc v1.51.0
+	google.golang.org/protobuf v1.30.0
+	gopkg.in/yaml.v3 v3.0.1
 	gorm.io/gorm v1.24.2
 )
 
@@ -20,6 +24,8 @@ require (
 	golang.org/x/net v0.2.0 // indirect
 	golang.org/x/sys v0.2.0 // indirect
 	golang.org/x/text v0.4.0 // indirect
-	google.golang.org/grpc v1.51.0 // indirect
-	google.golang.org/protobuf v1.30.0 // indirect
 )
+
+// github.com/tektoncd/results depends on an ancient release of go-sqlite3,
+// which lacks the JSON functions used by the SQLite dialect tests.
+replace github.com/mattn/go-sqlite3 => github.com/mattn/go-sqlite3 v1.14.17
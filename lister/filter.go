@@ -4,17 +4,35 @@ import (
 	"cel2sql/cel2sql"
 	"errors"
 	"strings"
+	"time"
 
 	pagetokenpb "cel2sql/lister/proto/pagetoken_go_proto"
 
 	"github.com/google/cel-go/cel"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	"gorm.io/gorm"
 )
 
+// filterCacheSize is the number of compiled filters shared by the listings.
+const filterCacheSize = 1000
+
+// filterCache holds the filters compiled with the default limits, so that the
+// pages of a listing, and the listings with the same filter, don't compile it
+// again.
+var filterCache = cel2sql.NewCache(filterCacheSize, cel2sql.WithLimits(cel2sql.DefaultLimits()))
+
 type filter struct {
 	env             *cel.Env
 	expr            string
 	equalityClauses []equalityClause
+
+	// limits bounds the cost of the filter. cel2sql.DefaultLimits are
+	// enforced if it's nil, and the compiled filter is cached.
+	limits *cel2sql.Limits
+
+	// now is the instant the CEL now() function refers to. See listingTime.
+	// The current time of the database is used if it's zero.
+	now time.Time
 }
 
 type equalityClause struct {
@@ -22,14 +40,46 @@ type equalityClause struct {
 	value      any
 }
 
-// validateToken implements the queryBuilder interface.
+// validateToken implements the queryBuilder interface. The filters are
+// compared by their canonical form, so that reformatting the filter or
+// reordering its && and || operands between pages doesn't invalidate the token.
 func (f *filter) validateToken(token *pagetokenpb.PageToken) error {
-	if strings.TrimSpace(f.expr) != strings.TrimSpace(token.Filter) {
+	if f.canonical(f.expr) != f.canonical(token.Filter) {
 		return errors.New("the filter in the token differs from the filter used in the previous query")
 	}
 	return nil
 }
 
+// writeToken implements the queryBuilder interface. The canonical form of the
+// filter is stored in the page token, along with the listing time.
+func (f *filter) writeToken(token *pagetokenpb.PageToken) {
+	token.Filter = f.tokenFilter()
+	if !f.now.IsZero() {
+		token.Now = timestamppb.New(f.now)
+	}
+}
+
+// tokenFilter returns the filter stored in the page tokens, which is the
+// canonical form of the filter.
+func (f *filter) tokenFilter() string {
+	return f.canonical(f.expr)
+}
+
+// canonical returns the canonical form of the provided filter. Filters that
+// can't be parsed are compared verbatim, and the error is reported when the
+// query is built.
+func (f *filter) canonical(expr string) string {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return ""
+	}
+	canonical, err := cel2sql.Canonicalize(f.env, expr)
+	if err != nil {
+		return expr
+	}
+	return canonical
+}
+
 // build implements the queryBuilder interface.
 func (f *filter) build(db *gorm.DB) (*gorm.DB, error) {
 	for _, clause := range f.equalityClauses {
@@ -37,11 +87,20 @@ func (f *filter) build(db *gorm.DB) (*gorm.DB, error) {
 	}
 
 	if expr := strings.TrimSpace(f.expr); expr != "" {
-		sql, err := cel2sql.Convert(f.env, expr)
+		compiled, err := f.compile(expr)
 		if err != nil {
 			return nil, err
 		}
-		db = db.Where(sql)
+		db = db.Where(compiled.SQL(), compiled.Vars()...)
 	}
 	return db, nil
 }
+
+// compile returns the compiled filter, which is cached unless the filter has
+// its own limits.
+func (f *filter) compile(expr string) (*cel2sql.Filter, error) {
+	if f.limits == nil {
+		return filterCache.Compile(f.env, expr, f.now)
+	}
+	return cel2sql.Compile(f.env, expr, cel2sql.WithLimits(*f.limits), cel2sql.WithNow(f.now))
+}
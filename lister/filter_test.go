@@ -3,7 +3,9 @@ package lister
 import (
 	"cel2sql/cel"
 	"testing"
+	"time"
 
+	"github.com/google/go-cmp/cmp"
 	"gorm.io/gorm/utils/tests"
 
 	pagetokenpb "cel2sql/lister/proto/pagetoken_go_proto"
@@ -13,8 +15,13 @@ import (
 )
 
 func TestFilterValidateToken(t *testing.T) {
-	filter := &filter{expr: `parent == "foo"`}
-	token := &pagetokenpb.PageToken{Filter: filter.expr}
+	env, err := cel.NewResultsEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filter := &filter{env: env, expr: `parent == "foo"`}
+	token := &pagetokenpb.PageToken{Filter: filter.tokenFilter()}
 
 	t.Run("valid token", func(t *testing.T) {
 		if err := filter.validateToken(token); err != nil {
@@ -22,6 +29,13 @@ func TestFilterValidateToken(t *testing.T) {
 		}
 	})
 
+	t.Run("token with an unparsable filter", func(t *testing.T) {
+		token := &pagetokenpb.PageToken{Filter: `parent ==`}
+		if err := filter.validateToken(token); err == nil {
+			t.Error("Want error, but got nil")
+		}
+	})
+
 	t.Run("invalid token", func(t *testing.T) {
 		token.Filter = `parent == "bar"`
 		if err := filter.validateToken(token); err == nil {
@@ -30,6 +44,19 @@ func TestFilterValidateToken(t *testing.T) {
 	})
 }
 
+func TestFilterValidateReformattedToken(t *testing.T) {
+	env, err := cel.NewResultsEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filter := &filter{env: env, expr: `parent=="foo"&&summary.status==SUCCESS`}
+	token := &pagetokenpb.PageToken{Filter: `summary.status == SUCCESS && parent == 'foo'`}
+	if err := filter.validateToken(token); err != nil {
+		t.Error(err)
+	}
+}
+
 func TestFilterBuild(t *testing.T) {
 	env, err := cel.NewResultsEnv()
 	if err != nil {
@@ -87,10 +114,41 @@ func TestFilterBuild(t *testing.T) {
 
 		testDB.Statement.Build("WHERE")
 
-		want := "WHERE recordsummary_status = 1"
+		want := "WHERE recordsummary_status = ?"
 		if got := testDB.Statement.SQL.String(); want != got {
 			t.Errorf("Want %q, but got %q", want, got)
 		}
+
+		wantVars := []any{int64(1)}
+		if diff := cmp.Diff(wantVars, testDB.Statement.Vars); diff != "" {
+			t.Errorf("Mismatch in the statement's vars (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("filter relative to the listing time", func(t *testing.T) {
+		now := time.Date(2023, 1, 16, 10, 0, 0, 0, time.UTC)
+		filter := &filter{
+			env:  env,
+			expr: `summary.start_time > now() - duration("1h")`,
+			now:  now,
+		}
+
+		testDB, err := filter.build(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		testDB.Statement.Build("WHERE")
+
+		want := "WHERE recordsummary_start_time > ?::TIMESTAMP WITH TIME ZONE - ?::INTERVAL"
+		if got := testDB.Statement.SQL.String(); want != got {
+			t.Errorf("Want %q, but got %q", want, got)
+		}
+
+		wantVars := []any{"2023-01-16T10:00:00Z", "3600 SECONDS"}
+		if diff := cmp.Diff(wantVars, testDB.Statement.Vars); diff != "" {
+			t.Errorf("Mismatch in the statement's vars (-want +got):\n%s", diff)
+		}
 	})
 
 	t.Run("more complex filter", func(t *testing.T) {
@@ -110,9 +168,38 @@ func TestFilterBuild(t *testing.T) {
 
 		testDB.Statement.Build("WHERE")
 
-		want := "WHERE parent = ? AND id = ? AND recordsummary_status <> 1"
+		want := "WHERE parent = ? AND id = ? AND recordsummary_status <> ?"
 		if got := testDB.Statement.SQL.String(); want != got {
 			t.Errorf("Want %q, but got %q", want, got)
 		}
+
+		wantVars := []any{"foo", "bar", int64(1)}
+		if diff := cmp.Diff(wantVars, testDB.Statement.Vars); diff != "" {
+			t.Errorf("Mismatch in the statement's vars (-want +got):\n%s", diff)
+		}
 	})
 }
+
+func TestFilterBuildCachesFilters(t *testing.T) {
+	env, err := cel.NewResultsEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, _ := gorm.Open(tests.DummyDialector{})
+	db.Statement = &gorm.Statement{DB: db, Clauses: map[string]clause.Clause{}}
+
+	expr := `summary.status == SUCCESS && annotations["repo"] == "cached"`
+	cached := filterCache.Len()
+	// The filter doesn't call now(), so listings at different times share it.
+	for page := 0; page < 2; page++ {
+		filter := &filter{env: env, expr: expr, now: time.Unix(int64(page), 0)}
+		if _, err := filter.build(db); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := filterCache.Len(); got != cached+1 {
+		t.Errorf("Want %d cached filters, but got %d", cached+1, got)
+	}
+}
@@ -1,10 +1,14 @@
 package lister
 
 import (
+	"cel2sql/cel2sql"
 	"context"
+	"errors"
+	"time"
 
 	pagetokenpb "cel2sql/lister/proto/pagetoken_go_proto"
 
+	"github.com/google/cel-go/cel"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"gorm.io/gorm"
@@ -13,6 +17,7 @@ import (
 type queryBuilder interface {
 	build(db *gorm.DB) (*gorm.DB, error)
 	validateToken(token *pagetokenpb.PageToken) error
+	writeToken(token *pagetokenpb.PageToken)
 }
 
 type Lister[I any, W any] struct {
@@ -20,18 +25,60 @@ type Lister[I any, W any] struct {
 	pageToken     *pagetokenpb.PageToken
 }
 
+// newLister returns a lister of the items that match the equality clauses and
+// the CEL filter, sorted as requested and starting after the last item of the
+// page token. The clock provides the instant the CEL now() function refers to
+// on the first page, which the following pages read from their page tokens.
+func newLister[I any, W any](env *cel.Env, equalityClauses []equalityClause, expr, orderBy string, pageToken *pagetokenpb.PageToken, clock func() time.Time) (*Lister[I, W], error) {
+	columnName, direction, err := parseOrderBy(orderBy)
+	if err != nil {
+		return nil, err
+	}
+	order := &order{columnName: columnName, direction: direction}
+	return &Lister[I, W]{
+		queryBuilders: []queryBuilder{
+			&offset{order: order, pageToken: pageToken},
+			&filter{
+				env:             env,
+				expr:            expr,
+				equalityClauses: equalityClauses,
+				now:             listingTime(pageToken, clock),
+			},
+			order,
+		},
+		pageToken: pageToken,
+	}, nil
+}
+
 func (l *Lister[I, W]) buildQuery(ctx context.Context, db *gorm.DB) (*gorm.DB, error) {
 	var err error
 	db = db.WithContext(ctx)
 	for _, builder := range l.queryBuilders {
-		if err := builder.validateToken(l.pageToken); err != nil {
-			return nil, status.Errorf(codes.InvalidArgument, "invalid page token: %v", err)
+		// The first page of a listing has no page token to validate.
+		if l.pageToken != nil {
+			if err := builder.validateToken(l.pageToken); err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid page token: %v", err)
+			}
 		}
 
 		db, err = builder.build(db)
+		if errors.Is(err, cel2sql.ErrFilterTooComplex) {
+			return nil, status.Errorf(codes.InvalidArgument, "%v; the filter is too expensive to run, simplify it or split it into several queries", err)
+		}
 		if err != nil {
 			return nil, status.Error(codes.InvalidArgument, err.Error())
 		}
 	}
 	return db, nil
 }
+
+// nextPageToken returns the encoded token of the page that follows the
+// provided item, which is the last one of the current page. The query builders
+// write the state shared by all the pages of the listing into the token.
+func (l *Lister[I, W]) nextPageToken(lastItem *pagetokenpb.Item) (string, error) {
+	token := &pagetokenpb.PageToken{LastItem: lastItem}
+	for _, builder := range l.queryBuilders {
+		builder.writeToken(token)
+	}
+	return EncodePageToken(token)
+}
@@ -2,6 +2,7 @@ package lister
 
 import (
 	"cel2sql/cel"
+	"cel2sql/cel2sql"
 	pagetokenpb "cel2sql/lister/proto/pagetoken_go_proto"
 	"context"
 	"strings"
@@ -9,6 +10,9 @@ import (
 	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/timestamppb"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
@@ -72,12 +76,12 @@ func TestBuildQuery(t *testing.T) {
 
 		testDB.Statement.Build("WHERE", "ORDER BY")
 
-		want := "WHERE (created_time, id) < (?, ?) AND parent = ? AND recordsummary_status = 1 ORDER BY created_time DESC,id DESC"
+		want := "WHERE (created_time, id) < (?, ?) AND parent = ? AND recordsummary_status = ? ORDER BY created_time DESC,id DESC"
 		if got := testDB.Statement.SQL.String(); want != got {
 			t.Errorf("Want %q, but got %q", want, got)
 		}
 
-		wantVars := []any{now, "bar", "foo"}
+		wantVars := []any{now, "bar", "foo", int64(1)}
 		if diff := cmp.Diff(wantVars, testDB.Statement.Vars); diff != "" {
 			t.Errorf("Mismatch in the statement's vars:\n%s", diff)
 		}
@@ -94,3 +98,129 @@ t.Fatalf("Unexpected error %v", err)
 		}
 	})
 }
+
+func TestBuildQueryWithTooComplexFilter(t *testing.T) {
+	env, err := cel.NewResultsEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, _ := gorm.Open(tests.DummyDialector{})
+	db.Statement = &gorm.Statement{DB: db, Clauses: map[string]clause.Clause{}}
+
+	expr := `summary.status == SUCCESS || summary.status == FAILURE`
+	lister := &Lister[any, any]{
+		queryBuilders: []queryBuilder{
+			&filter{
+				env:    env,
+				expr:   expr,
+				limits: &cel2sql.Limits{MaxNodes: 5},
+			},
+		},
+		pageToken: &pagetokenpb.PageToken{Filter: expr},
+	}
+
+	_, err = lister.buildQuery(context.Background(), db)
+	if got := status.Code(err); got != codes.InvalidArgument {
+		t.Fatalf("Want InvalidArgument, but got %v: %v", got, err)
+	}
+	want := "CEL filter too complex: it has 9 nodes, but at most 5 are allowed; the filter is too expensive to run, simplify it or split it into several queries"
+	if diff := cmp.Diff(want, status.Convert(err).Message()); diff != "" {
+		t.Errorf("Mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNextPageToken(t *testing.T) {
+	env, err := cel.NewResultsEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lister := &Lister[any, any]{
+		queryBuilders: []queryBuilder{
+			&filter{env: env, expr: ` summary.status==SUCCESS && parent=="foo" `},
+			&order{columnName: "created_time", direction: "DESC"},
+		},
+	}
+
+	lastItem := &pagetokenpb.Item{Id: "bar"}
+	encoded, err := lister.nextPageToken(lastItem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := DecodePageToken(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &pagetokenpb.PageToken{
+		Filter:   `parent == "foo" && summary.status == SUCCESS`,
+		LastItem: lastItem,
+	}
+	if diff := cmp.Diff(want, token,
+		cmpopts.IgnoreUnexported(pagetokenpb.PageToken{}, pagetokenpb.Item{})); diff != "" {
+		t.Errorf("Mismatch (-want +got):\n%s", diff)
+	}
+
+	t.Run("the token is valid for the reformatted filter", func(t *testing.T) {
+		next := &filter{env: env, expr: `parent == 'foo' && summary.status == SUCCESS`}
+		if err := next.validateToken(token); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestListerListingTime(t *testing.T) {
+	env, err := cel.NewResultsEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	firstPage := time.Date(2023, 1, 16, 10, 0, 0, 0, time.UTC)
+	expr := `summary.start_time > now() - duration("1h")`
+
+	// query builds the query of the page with the provided token at the time
+	// given by the clock, and returns the token of the following page.
+	query := func(t *testing.T, pageToken *pagetokenpb.PageToken, clock func() time.Time) ([]any, *pagetokenpb.PageToken) {
+		t.Helper()
+		lister, err := newLister[any, any](env, nil, expr, "", pageToken, clock)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		db, _ := gorm.Open(tests.DummyDialector{})
+		db.Statement = &gorm.Statement{DB: db, Clauses: map[string]clause.Clause{}}
+		testDB, err := lister.buildQuery(context.Background(), db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testDB.Statement.Build("WHERE")
+
+		encoded, err := lister.nextPageToken(&pagetokenpb.Item{Id: "bar"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		next, err := DecodePageToken(encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return testDB.Statement.Vars, next
+	}
+
+	vars, token := query(t, nil, func() time.Time {
+		return firstPage
+	})
+	want := []any{"2023-01-16T10:00:00Z", "3600 SECONDS"}
+	if diff := cmp.Diff(want, vars); diff != "" {
+		t.Errorf("Mismatch in the first page's vars (-want +got):\n%s", diff)
+	}
+
+	// The following pages are filtered relative to the time of the first one.
+	vars, _ = query(t, token, func() time.Time {
+		return firstPage.Add(time.Hour)
+	})
+	want = []any{"bar", "2023-01-16T10:00:00Z", "3600 SECONDS"}
+	if diff := cmp.Diff(want, vars); diff != "" {
+		t.Errorf("Mismatch in the second page's vars (-want +got):\n%s", diff)
+	}
+}
@@ -17,6 +17,9 @@ func (o *offset) validateToken(token *pagetokenpb.PageToken) error {
 	return nil
 }
 
+// writeToken implements the queryBuilder interface.
+func (o *offset) writeToken(token *pagetokenpb.PageToken) {}
+
 // build implements the queryBuilder interface.
 func (o *offset) build(db *gorm.DB) (*gorm.DB, error) {
 	if o.pageToken != nil {
@@ -37,6 +37,9 @@ func (o *order) validateToken(token *pagetokenpb.PageToken) error {
 	return nil
 }
 
+// writeToken implements the queryBuilder interface.
+func (o *order) writeToken(token *pagetokenpb.PageToken) {}
+
 // build implements the queryBuilder interface.
 func (o *order) build(db *gorm.DB) (*gorm.DB, error) {
 	direction := "ASC"
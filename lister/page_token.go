@@ -3,6 +3,7 @@ package lister
 import (
 	pagetokenpb "cel2sql/lister/proto/pagetoken_go_proto"
 	"encoding/base64"
+	"time"
 
 	"google.golang.org/protobuf/proto"
 )
@@ -28,3 +29,14 @@ func EncodePageToken(in *pagetokenpb.PageToken) (string, error) {
 	}
 	return base64.RawURLEncoding.EncodeToString(wire), nil
 }
+
+// listingTime returns the instant the CEL now() function refers to in the
+// listing the page token belongs to. The instant is carried over by the page
+// tokens, so that all pages of a listing are filtered consistently. The clock
+// provides it for the first page, which has no page token.
+func listingTime(token *pagetokenpb.PageToken, clock func() time.Time) time.Time {
+	if token != nil && token.Now != nil {
+		return token.Now.AsTime()
+	}
+	return clock()
+}
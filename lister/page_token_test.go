@@ -15,6 +15,7 @@ func TestEncodeAndDecodePageToken(t *testing.T) {
 	pageToken := &pagetokenpb.PageToken{
 		Parent: "foo",
 		Filter: "summary.status == SUCCESS",
+		Now:    timestamppb.New(time.Now()),
 		LastItem: &pagetokenpb.Item{
 			Id: "42",
 			OrderBy: &pagetokenpb.Order{